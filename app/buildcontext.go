@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignorePattern is a line of a .dockerignore file
+type ignorePattern struct {
+	pattern   string
+	re        *regexp.Regexp
+	exception bool // a !pattern that re-includes what earlier patterns excluded
+}
+
+// dockerignore holds the patterns of a build context's .dockerignore file
+type dockerignore []ignorePattern
+
+// readDockerignore reads dir/.dockerignore; a missing file ignores nothing
+func readDockerignore(dir string) (dockerignore, error) {
+	file, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns dockerignore
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{}
+		if p.exception = strings.HasPrefix(line, "!"); p.exception {
+			line = strings.TrimSpace(line[1:])
+		}
+		p.pattern = strings.Trim(path.Clean(filepath.ToSlash(line)), "/")
+		re, err := regexp.Compile(ignoreRegexp(p.pattern))
+		if err != nil {
+			return nil, err
+		}
+		p.re = re
+		patterns = append(patterns, p)
+	}
+	return patterns, scanner.Err()
+}
+
+// ignoreRegexp translates a .dockerignore pattern: * and ? stay within a path
+// component and ** spans any number of them
+func ignoreRegexp(pattern string) string {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
+
+// excluded reports whether the slash-separated path rel is left out of the
+// context. A pattern matching a directory excludes everything below it, and
+// the last matching pattern wins.
+func (d dockerignore) excluded(rel string) bool {
+	excluded := false
+	for _, p := range d {
+		for prefix := rel; prefix != "."; prefix = path.Dir(prefix) {
+			if p.re.MatchString(prefix) {
+				excluded = !p.exception
+				break
+			}
+		}
+	}
+	return excluded
+}
+
+// mayInclude reports whether an exception could re-include something below
+// the excluded directory rel, so it still has to be walked
+func (d dockerignore) mayInclude(rel string) bool {
+	for _, p := range d {
+		if p.exception && (strings.HasPrefix(p.pattern, rel+"/") || strings.ContainsAny(p.pattern, "*?[")) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkBuildContext calls fn for every file, directory and symlink of the build
+// context in dir, leaving out what .dockerignore excludes. Like docker build,
+// the Dockerfile and .dockerignore are always sent.
+func walkBuildContext(dir string, fn func(path, rel string, info os.FileInfo) error) error {
+	ignore, err := readDockerignore(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "Dockerfile" && rel != ".dockerignore" && ignore.excluded(rel) {
+			if info.IsDir() && !ignore.mayInclude(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(file, rel, info)
+	})
+}
+
+// buildContextHash fingerprints the files of the build context that are sent
+// to the engine, so an image built from an older Dockerfile or entrypoint.sh
+// can be told apart and rebuilt
+func buildContextHash(dir string) (string, error) {
+	hash := sha256.New()
+	err := walkBuildContext(dir, func(path, rel string, info os.FileInfo) error {
+		fmt.Fprintf(hash, "%s %o\n", rel, info.Mode())
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			fmt.Fprintf(hash, "-> %s\n", link)
+			return err
+		case info.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(hash, file)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read build context %s: %w", dir, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestWalkBuildContext(t *testing.T) {
+	files := []string{"Dockerfile", "entrypoint.sh", ".git/config", "app/main.go", "secrets.env", "conf/prod.env", "docs/keep.md", "docs/drop.md"}
+	for name, test := range map[string]struct {
+		ignore   string
+		expected []string
+	}{
+		"no dockerignore": {"", files},
+		"only the Dockerfile's files": {"*\n!Dockerfile\n!entrypoint.sh\n",
+			[]string{".dockerignore", "Dockerfile", "entrypoint.sh"}},
+		"patterns and exceptions": {"# comment\n**/*.env\n.git\n/docs/\n!docs/keep.md\n",
+			[]string{".dockerignore", "Dockerfile", "app/main.go", "docs/keep.md", "entrypoint.sh"}},
+	} {
+		dir := t.TempDir()
+		for _, file := range files {
+			os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0755)
+			os.WriteFile(filepath.Join(dir, file), []byte(file), 0644)
+		}
+		if test.ignore != "" {
+			os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(test.ignore), 0644)
+		}
+
+		var sent []string
+		err := walkBuildContext(dir, func(path, rel string, info os.FileInfo) error {
+			if !info.IsDir() {
+				sent = append(sent, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: walkBuildContext unexpected error: %v", name, err)
+		}
+		expected := slices.Clone(test.expected)
+		sort.Strings(expected)
+		sort.Strings(sent)
+		if !slices.Equal(sent, expected) {
+			t.Errorf("%s: context = %v, expected %v", name, sent, expected)
+		}
+	}
+}
+
+func TestTarDirectoryStreamsContext(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("*.key\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "id.key"), []byte("secret"), 0600)
+
+	archive := tarDirectory(dir)
+	defer archive.Close()
+	var names []string
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading the build context: %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	if !slices.Equal(names, []string{".dockerignore", "Dockerfile"}) {
+		t.Errorf("archive = %v, expected the Dockerfile without id.key", names)
+	}
+
+	if _, err := io.ReadAll(tarDirectory(filepath.Join(dir, "missing"))); err == nil {
+		t.Error("reading the context of a missing directory should fail")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// labResource is a runtime resource owned by a lab
+type labResource struct {
+	Kind string // container, volume, network or image
+	Name string
+	ID   string
+}
+
+// cleanPlan lists the resources clean removes for the spec's lab. Containers come
+// first because volumes and networks cannot be removed while they are in use.
+// The lab image is included only when the tool built it, so it carries the
+// image role label, and no other lab's containers use it.
+func (a *App) cleanPlan(ctx context.Context, spec *LabSpec) ([]labResource, error) {
+	var plan []labResource
+
+	containers, err := a.Runtime.ListContainers(ctx, ListOptions{All: true, Labels: roleLabels(spec, roleNode)})
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range containers {
+		plan = append(plan, labResource{Kind: "container", Name: container.Name, ID: container.ID})
+	}
+
+	volumes, err := a.Runtime.ListVolumes(ctx, ListOptions{Labels: roleLabels(spec, roleVolume)})
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range volumes {
+		plan = append(plan, labResource{Kind: "volume", Name: volume.Name})
+	}
+
+	networks, err := a.Runtime.ListNetworks(ctx, ListOptions{Labels: roleLabels(spec, roleNetwork)})
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range networks {
+		plan = append(plan, labResource{Kind: "network", Name: network.Name})
+	}
+
+	exists, err := a.Runtime.ImageExists(ctx, spec.Image.Name)
+	if err != nil || !exists {
+		return plan, err
+	}
+	// Pulled images such as ubuntu:22.04 may be used outside any lab
+	labels, err := a.Runtime.ImageLabels(ctx, spec.Image.Name)
+	if err != nil {
+		return nil, err
+	}
+	if labels[labRoleLabel] != roleImage {
+		return plan, nil
+	}
+	others, err := a.Runtime.ListContainers(ctx, ListOptions{All: true, Labels: allNodeLabels()})
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range others {
+		if lab := container.Labels[labNameLabel]; lab != spec.Name && container.Image == spec.Image.Name {
+			fmt.Fprintf(a.Out, "%s Keeping image %s - still used by lab %s\n", yellow("⚠️"), spec.Image.Name, lab)
+			return plan, nil
+		}
+	}
+	return append(plan, labResource{Kind: "image", Name: spec.Image.Name}), nil
+}
+
+// removeResource deletes a single resource from the plan
+func (a *App) removeResource(ctx context.Context, resource labResource) error {
+	switch resource.Kind {
+	case "container":
+		return a.Runtime.RemoveContainer(ctx, resource.ID)
+	case "volume":
+		return a.Runtime.RemoveVolume(ctx, resource.Name)
+	case "network":
+		return a.Runtime.RemoveNetwork(ctx, resource.Name)
+	case "image":
+		return a.Runtime.RemoveImage(ctx, resource.Name)
+	}
+	return fmt.Errorf("unknown resource kind %q", resource.Kind)
+}
+
+// confirm asks a yes/no question on a.Out and reads the answer from a.In
+func (a *App) confirm(question string) bool {
+	fmt.Fprintf(a.Out, "%s %s [y/N]: ", yellow("❓"), question)
+	if a.In == nil {
+		fmt.Fprintln(a.Out)
+		return false
+	}
+	answer, _ := bufio.NewReader(a.In).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// cleanLab removes the lab's own containers, volumes, networks and image. With
+// dryRun it only lists them; unless yes is set it asks before removing anything.
+func (a *App) cleanLab(ctx context.Context, spec *LabSpec, dryRun, yes bool) error {
+	fmt.Fprintf(a.Out, "\n%s %s\n", red("🧹"), bold("Cleaning LAB environment..."))
+	fmt.Fprintf(a.Out, "%s\n", blue("══════════════════════════════════"))
+
+	plan, err := a.cleanPlan(ctx, spec)
+	if err != nil {
+		return err
+	}
+	if len(plan) == 0 {
+		fmt.Fprintf(a.Out, "%s Nothing to clean for lab %s\n", green("✅"), bold(spec.Name))
+		return nil
+	}
+
+	fmt.Fprintf(a.Out, "%s Resources of lab %s:\n", cyan("📋"), bold(spec.Name))
+	for _, resource := range plan {
+		fmt.Fprintf(a.Out, "  %s %-9s %s\n", blue("•"), resource.Kind, resource.Name)
+	}
+
+	if dryRun {
+		fmt.Fprintf(a.Out, "\n%s Dry run - nothing was removed\n", cyan("💡"))
+		return nil
+	}
+	if !yes && !a.confirm(fmt.Sprintf("Remove these %d resources?", len(plan))) {
+		return errors.New("clean aborted - nothing was removed")
+	}
+
+	fmt.Fprintln(a.Out)
+	failed := 0
+	for _, resource := range plan {
+		if err := a.removeResource(ctx, resource); err != nil {
+			failed++
+			fmt.Fprintf(a.Out, "  %s %s %s: %v\n", red("❌"), resource.Kind, resource.Name, err)
+			continue
+		}
+		fmt.Fprintf(a.Out, "  %s Removed %s %s\n", green("✓"), resource.Kind, resource.Name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to remove %d of %d resources of lab %s", failed, len(plan), spec.Name)
+	}
+	if err := a.removeState(spec.Name); err != nil {
+		return fmt.Errorf("failed to remove state of lab %s: %w", spec.Name, err)
+	}
+
+	// Note: lab.yaml is preserved to maintain user customizations
+	fmt.Fprintf(a.Out, "\n%s Lab environment cleaned completely!\n", green("✅"))
+	fmt.Fprintf(a.Out, "%s Lab configuration preserved - use %s to start again\n", cyan("💡"), green("./lab init"))
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newCleanTestApp returns an App with the default lab initialized
+func newCleanTestApp(t *testing.T) (*App, *fakeRuntime, *LabSpec, *bytes.Buffer) {
+	app, rt, _, out := newTestApp()
+	spec := defaultSpec(defaultLabName, 2)
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+	out.Reset()
+	return app, rt, spec, out
+}
+
+func TestCleanLabDryRun(t *testing.T) {
+	app, rt, spec, out := newCleanTestApp(t)
+
+	if err := app.cleanLab(context.Background(), spec, true, false); err != nil {
+		t.Fatalf("cleanLab dry run unexpected error: %v", err)
+	}
+	for _, expected := range []string{"container lab-01", "volume    lab-02-services", "network   lab-network", "image     " + defaultImage, "Dry run"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("dry run output missing %q:\n%s", expected, out.String())
+		}
+	}
+	if rt.called("remove") || len(rt.containers) != 2 {
+		t.Errorf("dry run removed resources: %v", rt.calls)
+	}
+}
+
+func TestCleanLabConfirmation(t *testing.T) {
+	tests := []struct {
+		answer  string
+		removed bool
+	}{
+		{"", false},
+		{"n\n", false},
+		{"yes\n", true},
+		{"Y\n", true},
+	}
+
+	for _, test := range tests {
+		app, rt, spec, _ := newCleanTestApp(t)
+		app.In = strings.NewReader(test.answer)
+
+		err := app.cleanLab(context.Background(), spec, false, false)
+		if test.removed != (err == nil) {
+			t.Errorf("answer %q: cleanLab error = %v", test.answer, err)
+		}
+		if test.removed != (len(rt.containers) == 0) {
+			t.Errorf("answer %q: %d containers left, expected removed=%v", test.answer, len(rt.containers), test.removed)
+		}
+	}
+}
+
+func TestCleanLabReportsFailures(t *testing.T) {
+	app, rt, spec, out := newCleanTestApp(t)
+	rt.removeErrors = map[string]error{"lab-01-home": errors.New("volume is in use")}
+
+	err := app.cleanLab(context.Background(), spec, false, true)
+	if err == nil || !strings.Contains(err.Error(), "failed to remove 1 of") {
+		t.Errorf("cleanLab error = %v, expected one failure", err)
+	}
+	if !strings.Contains(out.String(), "volume lab-01-home: volume is in use") {
+		t.Errorf("output missing the failed volume:\n%s", out.String())
+	}
+	if _, ok := rt.networks["lab-network"]; ok {
+		t.Errorf("cleanLab stopped at the first failure instead of removing the network")
+	}
+}
+
+func TestCleanLabKeepsImagesItDidNotBuild(t *testing.T) {
+	app, rt, spec, out := newCleanTestApp(t)
+	// A registry image set in lab.yaml, pulled rather than built by the tool
+	rt.imageLabels[defaultImage] = map[string]string{"org.opencontainers.image.version": "22.04"}
+
+	if err := app.cleanLab(context.Background(), spec, false, true); err != nil {
+		t.Fatalf("cleanLab unexpected error: %v", err)
+	}
+	if !rt.images[defaultImage] || strings.Contains(out.String(), "image     "+defaultImage) {
+		t.Errorf("cleanLab should keep an image without the lab image label:\n%s", out.String())
+	}
+}
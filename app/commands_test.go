@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestApp returns an App wired to fakes, writing its output to a buffer
+func newTestApp() (*App, *fakeRuntime, *fakeDialer, *bytes.Buffer) {
+	rt := newFakeRuntime()
+	dialer := &fakeDialer{}
+	out := &bytes.Buffer{}
+	portFree := func(port int) bool { return true }
+	return &App{Runtime: rt, SSH: dialer, Out: out, PortFree: portFree}, rt, dialer, out
+}
+
+func TestInitLabCreatesResources(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	spec := defaultSpec(defaultLabName, 2)
+
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+
+	for _, call := range []string{
+		"build image " + defaultImage,
+		"create network lab-network",
+		"create volume lab-01-home",
+		"create container lab-01",
+		"start container lab-02",
+	} {
+		if !rt.called(call) {
+			t.Errorf("expected call %q, got %v", call, rt.calls)
+		}
+	}
+	if !strings.Contains(out.String(), "ssh labuser@localhost -p 2223") {
+		t.Errorf("output missing connection details:\n%s", out.String())
+	}
+}
+
+func TestInitLabRefusesRunningLab(t *testing.T) {
+	app, rt, _, _ := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+
+	err := app.initLab(context.Background(), defaultSpec(defaultLabName, 2))
+	if err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("initLab error = %v, expected already running error", err)
+	}
+	if rt.called("create container") {
+		t.Errorf("initLab created containers for a running lab: %v", rt.calls)
+	}
+}
+
+func TestStartLabWithoutContainers(t *testing.T) {
+	app, _, _, _ := newTestApp()
+
+	if err := app.startLab(context.Background(), defaultSpec(defaultLabName, 2)); err == nil {
+		t.Errorf("startLab expected error without containers, got nil")
+	}
+}
+
+func TestStopAndCleanLab(t *testing.T) {
+	app, rt, _, _ := newTestApp()
+	spec := defaultSpec(defaultLabName, 2)
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+
+	if err := app.stopLab(context.Background(), spec); err != nil {
+		t.Fatalf("stopLab unexpected error: %v", err)
+	}
+	if containers, _ := app.getContainers(context.Background(), spec); len(containers) != 0 {
+		t.Errorf("getContainers after stop = %d containers, expected none running", len(containers))
+	}
+
+	if err := app.cleanLab(context.Background(), spec, false, true); err != nil {
+		t.Fatalf("cleanLab unexpected error: %v", err)
+	}
+	if len(rt.containers) != 0 || len(rt.networks) != 0 || len(rt.volumes) != 0 || rt.images[defaultImage] {
+		t.Errorf("cleanLab left containers=%d networks=%d volumes=%d image=%v",
+			len(rt.containers), len(rt.networks), len(rt.volumes), rt.images[defaultImage])
+	}
+}
+
+func TestShowStatus(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	if err := app.showStatus(context.Background(), defaultSpec(defaultLabName, 2), "", ""); err != nil {
+		t.Fatalf("showStatus unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "No containers running for lab") {
+		t.Errorf("output missing warning for an empty lab:\n%s", out.String())
+	}
+
+	out.Reset()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	if err := app.showStatus(context.Background(), defaultSpec(defaultLabName, 2), "", ""); err != nil {
+		t.Fatalf("showStatus unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "2222") || !strings.Contains(out.String(), "lab-01") {
+		t.Errorf("output missing lab-01 on port 2222:\n%s", out.String())
+	}
+}
+
+func TestGroupsFromInitSelectNodes(t *testing.T) {
+	app, _, _, out := newTestApp()
+	app.StateDir = t.TempDir()
+	spec := defaultSpec(defaultLabName, 3)
+	spec.Groups = map[string]GroupSpec{"web": {Hosts: []string{"lab-02", "lab-03"}}}
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Groups: web (2)") {
+		t.Errorf("init output missing the groups:\n%s", out.String())
+	}
+
+	// Later commands without --group get the groups recorded by init
+	loaded := defaultSpec(defaultLabName, 3)
+	if err := app.applyState(loaded); err != nil {
+		t.Fatalf("applyState unexpected error: %v", err)
+	}
+	out.Reset()
+	if err := app.showStatus(context.Background(), loaded, "", "web"); err != nil {
+		t.Fatalf("showStatus --group web unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), "lab-01") || !strings.Contains(out.String(), "lab-02") || !strings.Contains(out.String(), "lab-03") {
+		t.Errorf("status --group web should only show lab-02 and lab-03:\n%s", out.String())
+	}
+	if err := app.showStatus(context.Background(), loaded, "", "db"); err == nil {
+		t.Errorf("showStatus with an unknown group expected an error")
+	}
+}
+
+func TestGenerateInventory(t *testing.T) {
+	app, rt, _, _ := newTestApp()
+	path := filepath.Join(t.TempDir(), "inventory.yml")
+
+	if err := app.generateInventory(context.Background(), defaultSpec(defaultLabName, 2), inventoryOptions{Path: path}); !errors.Is(err, errNoContainers) {
+		t.Errorf("generateInventory error = %v, expected errNoContainers", err)
+	}
+
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	if err := app.generateInventory(context.Background(), defaultSpec(defaultLabName, 2), inventoryOptions{Path: path}); err != nil {
+		t.Fatalf("generateInventory unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("inventory not written: %v", err)
+	}
+	if !strings.Contains(string(content), "ansible_port: 2222") {
+		t.Errorf("inventory missing lab-01 port:\n%s", content)
+	}
+}
+
+func TestLabsRunSideBySide(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	lab := defaultSpec(defaultLabName, 2)
+	db := defaultSpec("db", 2)
+	db.Nodes[1].Name = "replica"
+
+	if err := app.initLab(context.Background(), lab); err != nil {
+		t.Fatalf("initLab(lab) unexpected error: %v", err)
+	}
+	if err := app.initLab(context.Background(), db); err != nil {
+		t.Fatalf("initLab(db) unexpected error: %v", err)
+	}
+
+	config := rt.configs["db-replica"]
+	if config.Hostname != "replica" || config.Networks[0] != "db-network" || config.Mounts[0].Volume != "db-replica-home" {
+		t.Errorf("db-replica config = %+v, expected namespaced network and volumes", config)
+	}
+	if port := rt.configs["db-replica"].Ports[0].HostPort; db.sshPort(db.Nodes[0]) != 2224 || port != 2225 {
+		t.Errorf("db ssh ports = %d, %d, expected the first free ports 2224-2225", db.sshPort(db.Nodes[0]), port)
+	}
+
+	if err := app.cleanLab(context.Background(), db, false, true); err != nil {
+		t.Fatalf("cleanLab(db) unexpected error: %v", err)
+	}
+	if containers, _ := app.getContainers(context.Background(), lab); len(containers) != 2 {
+		t.Errorf("cleaning db left %d lab containers, expected 2", len(containers))
+	}
+	if _, ok := rt.networks["lab-network"]; !ok || !rt.images[defaultImage] {
+		t.Errorf("cleaning db removed resources still used by lab")
+	}
+	if _, ok := rt.volumes["db-replica-home"]; ok {
+		t.Errorf("cleaning db left volume db-replica-home")
+	}
+
+	out.Reset()
+	rt.addContainer("web", "web-01", "exited", 2400)
+	if err := app.listLabs(context.Background()); err != nil {
+		t.Fatalf("listLabs unexpected error: %v", err)
+	}
+	output := out.String()
+	if !strings.Contains(output, "2222-2223") || !strings.Contains(output, "web") || strings.Contains(output, "db") {
+		t.Errorf("listLabs output should show lab and web only:\n%s", output)
+	}
+}
+
+func TestInitLabRejectsPortClashInSpecFile(t *testing.T) {
+	app, rt, _, _ := newTestApp()
+	rt.addContainer("other", "other-01", "running", 2222)
+	spec := defaultSpec("db", 1)
+	spec.source = "db.yaml"
+	spec.Nodes[0].pinnedPort = true
+
+	err := app.initLab(context.Background(), spec)
+	if err == nil || !strings.Contains(err.Error(), `host port 2222 is already used by lab "other" - change nodes[0].ssh_port in db.yaml`) {
+		t.Errorf("initLab error = %v, expected a port clash with lab other", err)
+	}
+}
+
+func TestAllocatePortsSkipsBoundPortsAndRecordsState(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	app.StateDir = t.TempDir()
+	app.PortFree = func(port int) bool { return port != 2222 }
+	rt.addContainer("other", "other-01", "exited", 2224)
+
+	if err := app.initLab(context.Background(), defaultSpec(defaultLabName, 2)); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+	state, err := app.loadState(defaultLabName)
+	if err != nil || state.Nodes["lab-01"].SSHPort != 2223 || state.Nodes["lab-02"].SSHPort != 2225 {
+		t.Fatalf("state = %+v, %v, expected lab-01 on 2223 and lab-02 on 2225", state, err)
+	}
+
+	// A later invocation reads the ports back even when the runtime does not report them
+	for _, container := range rt.containers {
+		container.Ports = nil
+	}
+	spec := defaultSpec(defaultLabName, 2)
+	if err := app.applyState(spec); err != nil {
+		t.Fatalf("applyState unexpected error: %v", err)
+	}
+	out.Reset()
+	if err := app.showStatus(context.Background(), spec, "", ""); err != nil {
+		t.Fatalf("showStatus unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "labuser@localhost -p 2225") {
+		t.Errorf("status should show lab-02 on its allocated port:\n%s", out.String())
+	}
+
+	if err := app.cleanLab(context.Background(), spec, false, true); err != nil {
+		t.Fatalf("cleanLab unexpected error: %v", err)
+	}
+	if state, _ := app.loadState(defaultLabName); len(state.Nodes) != 0 {
+		t.Errorf("clean left nodes in the state: %v", state.Nodes)
+	}
+}
+
+func TestAllocatePortsRangeExhausted(t *testing.T) {
+	app, _, _, _ := newTestApp()
+	app.PortFree = func(port int) bool { return port > 2223 }
+	spec := defaultSpec(defaultLabName, 2)
+	spec.Ports.SSHRange = "2222-2224"
+
+	err := app.allocatePorts(context.Background(), spec)
+	if err == nil || !strings.Contains(err.Error(), "no free SSH port left in 2222-2224 for node lab-02") {
+		t.Errorf("allocatePorts error = %v, expected the range to run out", err)
+	}
+}
+
+func TestCommandsIgnoreUnlabelledResources(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	rt.addContainer("", "my-lab-db", "running", 5432)
+	rt.volumes["my-lab-db-home"] = Volume{Name: "my-lab-db-home"}
+	rt.networks["lab-network"] = Network{Name: "lab-network"}
+	spec := defaultSpec(defaultLabName, 1)
+
+	if err := app.showStatus(context.Background(), spec, "", ""); err != nil {
+		t.Fatalf("showStatus unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), "my-lab-db") {
+		t.Errorf("status shows an unlabelled container:\n%s", out.String())
+	}
+
+	// The unlabelled lab-network is not adopted
+	if err := app.initLab(context.Background(), spec); err == nil {
+		t.Errorf("initLab expected error for an existing unlabelled network, got nil")
+	}
+	delete(rt.networks, "lab-network")
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+	labels := rt.configs["lab-01"].Labels
+	if labels[labNodeLabel] != "lab-01" || labels[labRoleLabel] != roleNode || labels[labSpecHashLabel] != specHash(spec) {
+		t.Errorf("container labels = %v, expected node, role and spec hash", labels)
+	}
+	if rt.volumes["lab-01-home"].Labels[labNameLabel] != defaultLabName || rt.networks["lab-network"].Labels[labRoleLabel] != roleNetwork {
+		t.Errorf("volume and network were created without ownership labels")
+	}
+
+	if err := app.cleanLab(context.Background(), spec, false, true); err != nil {
+		t.Fatalf("cleanLab unexpected error: %v", err)
+	}
+	if _, ok := rt.containers["my-lab-db"]; !ok {
+		t.Errorf("cleanLab removed the unlabelled container my-lab-db")
+	}
+	if _, ok := rt.volumes["my-lab-db-home"]; !ok || len(rt.volumes) != 1 {
+		t.Errorf("cleanLab volumes left = %v, expected only my-lab-db-home", rt.volumes)
+	}
+}
+
+func TestCreateVolumeRefusesForeignVolume(t *testing.T) {
+	app, rt, _, _ := newTestApp()
+	rt.volumes["lab-01-home"] = Volume{Name: "lab-01-home", Labels: map[string]string{labNameLabel: "other"}}
+	spec := defaultSpec(defaultLabName, 1)
+
+	err := app.createVolume(context.Background(), spec, spec.Nodes[0], "lab-01-home")
+	if err == nil || !strings.Contains(err.Error(), "does not belong to lab") {
+		t.Errorf("createVolume error = %v, expected an ownership error", err)
+	}
+}
+
+func TestEnsureImagesRebuildsStaleImage(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM ubuntu:22.04\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "entrypoint.sh"), []byte("#!/bin/sh\n"), 0755)
+	spec := defaultSpec(defaultLabName, 1)
+	spec.Image.Build = dir
+
+	// An image built before images were labelled has no build hash
+	rt.images[defaultImage] = true
+	builds := func() int {
+		n := 0
+		for _, call := range rt.calls {
+			if call == "build image "+defaultImage {
+				n++
+			}
+		}
+		return n
+	}
+
+	for i, expected := range []int{1, 1, 2} {
+		if i == 2 {
+			os.WriteFile(filepath.Join(dir, "entrypoint.sh"), []byte("#!/bin/sh\necho $AUTHORIZED_KEY\n"), 0755)
+		}
+		if err := app.ensureImages(context.Background(), spec); err != nil {
+			t.Fatalf("ensureImages unexpected error: %v", err)
+		}
+		if builds() != expected {
+			t.Errorf("run %d: %d builds, expected %d", i+1, builds(), expected)
+		}
+	}
+	if !strings.Contains(out.String(), "Rebuilding image "+defaultImage) {
+		t.Errorf("expected the rebuild to be reported, got:\n%s", out)
+	}
+	if labels := rt.imageLabels[defaultImage]; labels[labRoleLabel] != roleImage || labels[labBuildHashLabel] == "" {
+		t.Errorf("image labels = %v, expected the image role and build hash", labels)
+	}
+}
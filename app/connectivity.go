@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultParallel is the number of nodes `test` checks at the same time
+const defaultParallel = 10
+
+// hostKeyRecorder is implemented by dialers that capture host keys
+type hostKeyRecorder interface {
+	HostKey(target SSHTarget) ssh.PublicKey
+}
+
+// sshTarget returns the SSH endpoint and credentials for a node published on port
+func (a *App) sshTarget(spec *LabSpec, port int) SSHTarget {
+	target := SSHTarget{Host: "localhost", Port: port, User: spec.User.Name, KeyFile: a.IdentityFile}
+	if target.KeyFile == "" {
+		target.KeyFile = spec.keyFile
+	}
+	if *spec.User.PasswordAuth {
+		target.Password = spec.User.Password
+	}
+	return target
+}
+
+// nodeCheck is the outcome of the SSH check of one node
+type nodeCheck struct {
+	Node        string
+	Port        int
+	Duration    time.Duration
+	Err         error
+	Fingerprint string // host key fingerprint, when the dialer captured one
+}
+
+// checkNode runs the SSH test command on a single node
+func (a *App) checkNode(ctx context.Context, spec *LabSpec, node string, port int) nodeCheck {
+	check := nodeCheck{Node: node, Port: port}
+	target := a.sshTarget(spec, port)
+
+	start := time.Now()
+	output, err := a.SSH.Run(ctx, target, "echo 'SSH_OK'")
+	check.Duration = time.Since(start)
+
+	switch {
+	case err != nil:
+		check.Err = err
+	case !strings.Contains(output, "SSH_OK"):
+		check.Err = fmt.Errorf("unexpected output %q", output)
+	default:
+		if recorder, ok := a.SSH.(hostKeyRecorder); ok && recorder.HostKey(target) != nil {
+			check.Fingerprint = ssh.FingerprintSHA256(recorder.HostKey(target))
+		}
+	}
+	return check
+}
+
+// checkNodes checks every node with SSH published using at most parallel
+// workers. report is called for each result in node order as soon as it and
+// all results before it are known.
+func (a *App) checkNodes(ctx context.Context, spec *LabSpec, containers []Container, parallel int, report func(nodeCheck)) []nodeCheck {
+	var checks []nodeCheck
+	for _, container := range containers {
+		if port := spec.containerSSHPort(container); container.Running() && port != 0 {
+			checks = append(checks, nodeCheck{Node: spec.nodeName(container), Port: port})
+		}
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	done := make([]chan struct{}, len(checks))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel && w < len(checks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				checks[i] = a.checkNode(ctx, spec, checks[i].Node, checks[i].Port)
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range checks {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	for i := range checks {
+		<-done[i]
+		report(checks[i])
+	}
+	wg.Wait()
+	return checks
+}
+
+// testOptions controls how `test` checks the lab and reports the results
+type testOptions struct {
+	Parallel int
+	Format   string    // json, junit or tap; empty for the human-readable output only
+	Report   io.Writer // destination of the machine-readable report
+	Nodes    string    // node names or glob patterns to test; empty tests all
+	Group    string    // spec group to test
+}
+
+func (a *App) testConnectivity(ctx context.Context, spec *LabSpec, opts testOptions) error {
+	fmt.Fprintf(a.Out, "\n%s %s\n", blue("🧪"), bold("Testing LAB Connectivity"))
+	fmt.Fprintf(a.Out, "%s\n", blue("═══════════════════════════════════"))
+
+	// Check if containers are running
+	containers, err := a.getContainers(ctx, spec)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return errNoContainers
+	}
+	if opts.Nodes != "" || opts.Group != "" {
+		if containers, err = filterNodes(spec, containers, opts.Nodes, opts.Group); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(a.Out, "\n%s\n", bold("SSH Connectivity Tests:"))
+
+	start := time.Now()
+	report := &testReport{Lab: spec.Name}
+	var failures []string
+	checks := a.checkNodes(ctx, spec, containers, opts.Parallel, func(check nodeCheck) {
+		report.Cases = append(report.Cases, check.testCase())
+		fmt.Fprintf(a.Out, "  %s %s (port %d) ", blue("→"), bold(check.Node), check.Port)
+		if check.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s (%s)", check.Node, sshReason(check.Err)))
+			fmt.Fprintf(a.Out, "%s (%s) %s\n", red("FAILED"), sshReason(check.Err), formatLatency(check.Duration))
+			return
+		}
+		fmt.Fprintf(a.Out, "%s %s", green("PASSED"), formatLatency(check.Duration))
+		if check.Fingerprint != "" {
+			fmt.Fprintf(a.Out, " %s", cyan(check.Fingerprint))
+		}
+		fmt.Fprintln(a.Out)
+	})
+	fmt.Fprintf(a.Out, "  %s Checked %d nodes in %s\n", cyan("⏱️"), len(checks), formatLatency(time.Since(start)))
+
+	// Test Ansible if available
+	fmt.Fprintf(a.Out, "\n%s\n", bold("Ansible Connectivity Tests:"))
+
+	total := len(checks)
+	if a.Ansible == nil {
+		fmt.Fprintf(a.Out, "  %s Ansible not installed - skipping Ansible tests\n", yellow("⚠️"))
+		fmt.Fprintf(a.Out, "  %s Install with: sudo apt install ansible\n", cyan("💡"))
+		report.Cases = append(report.Cases, testCase{Suite: "ansible", Name: "ping", Status: statusSkipped, Message: "Ansible not installed"})
+	} else {
+		total++
+		result := a.testAnsible(ctx, spec, containers)
+		report.Cases = append(report.Cases, result)
+		if result.Status == statusFailed {
+			failures = append(failures, "ansible")
+		}
+	}
+	report.Duration = time.Since(start)
+
+	if opts.Format != "" {
+		if err := report.write(opts.Report, opts.Format); err != nil {
+			return fmt.Errorf("failed to write %s report: %w", opts.Format, err)
+		}
+	}
+
+	fmt.Fprintf(a.Out, "\n%s\n", bold("Test Summary:"))
+	if len(failures) == 0 {
+		fmt.Fprintf(a.Out, "  %s All %d connectivity tests passed!\n", green("✅"), total)
+		fmt.Fprintln(a.Out)
+		return nil
+	}
+	fmt.Fprintf(a.Out, "  %s %d of %d tests failed: %s\n", red("❌"), len(failures), total, strings.Join(failures, ", "))
+	fmt.Fprintln(a.Out)
+	return fmt.Errorf("%d of %d connectivity tests failed - check SSH configuration", len(failures), total)
+}
+
+// testCase converts an SSH check into a report entry
+func (c nodeCheck) testCase() testCase {
+	result := testCase{Suite: "ssh", Name: c.Node, Status: statusPassed, Duration: c.Duration}
+	if c.Err != nil {
+		result.Status = statusFailed
+		result.Message = sshReason(c.Err)
+		result.Detail = fmt.Sprintf("port %d: %v", c.Port, c.Err)
+	}
+	return result
+}
+
+// formatLatency rounds a duration for display
+func formatLatency(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(10 * time.Millisecond).String()
+}
+
+// testAnsible pings every node through a temporary inventory
+func (a *App) testAnsible(ctx context.Context, spec *LabSpec, containers []Container) testCase {
+	result := testCase{Suite: "ansible", Name: "ping", Status: statusFailed}
+
+	dir, err := os.MkdirTemp("", "lab-inventory-")
+	if err != nil {
+		return a.ansibleInventoryFailed(result, err)
+	}
+	defer os.RemoveAll(dir)
+
+	inventoryPath := filepath.Join(dir, "inventory-test.yml")
+	content, err := generateInventoryContent(spec, containers, nil)
+	if err != nil {
+		return a.ansibleInventoryFailed(result, err)
+	}
+	if err := os.WriteFile(inventoryPath, []byte(content), 0600); err != nil {
+		return a.ansibleInventoryFailed(result, err)
+	}
+
+	fmt.Fprintf(a.Out, "  %s Testing Ansible ping... ", blue("→"))
+	start := time.Now()
+	output, err := a.Ansible(ctx, inventoryPath)
+	result.Duration = time.Since(start)
+	switch {
+	case err != nil:
+		fmt.Fprintf(a.Out, "%s\n", red("FAILED"))
+		fmt.Fprintf(a.Out, "    %s\n", output)
+		result.Message = err.Error()
+		result.Detail = output
+	case strings.Contains(output, "SUCCESS"):
+		fmt.Fprintf(a.Out, "%s\n", green("PASSED"))
+		result.Status = statusPassed
+	default:
+		fmt.Fprintf(a.Out, "%s\n", yellow("PARTIAL"))
+		result.Message = "not every node answered the ping"
+		result.Detail = output
+	}
+	return result
+}
+
+func (a *App) ansibleInventoryFailed(result testCase, err error) testCase {
+	fmt.Fprintf(a.Out, "  %s Failed to create test inventory: %v\n", red("❌"), err)
+	result.Message = "failed to create test inventory"
+	result.Detail = err.Error()
+	return result
+}
+
+// runAnsiblePing runs `ansible lab_nodes -m ping` against an inventory file
+func runAnsiblePing(ctx context.Context, inventoryPath string) (string, error) {
+	output, err := exec.CommandContext(ctx, "ansible", "-i", inventoryPath, "lab_nodes", "-m", "ping").CombinedOutput()
+	return string(output), err
+}
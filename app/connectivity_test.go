@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTestConnectivity(t *testing.T) {
+	app, rt, dialer, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	dialer.failures = map[int]error{2223: &SSHError{Reason: reasonRefused, Err: errors.New("dial tcp 127.0.0.1:2223")}}
+
+	err := app.testConnectivity(context.Background(), defaultSpec(defaultLabName, 2), testOptions{Parallel: defaultParallel})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 connectivity tests failed") {
+		t.Errorf("testConnectivity error = %v, expected 1 of 2 failed", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "PASSED") || !strings.Contains(output, "FAILED (connection refused)") {
+		t.Errorf("output should report lab-01 passing and lab-02 failing:\n%s", output)
+	}
+	if !strings.Contains(output, "Ansible not installed") || !strings.Contains(output, "1 of 2 tests failed: lab-02 (connection refused)") {
+		t.Errorf("output missing Ansible skip or failure summary:\n%s", output)
+	}
+	sort.Strings(dialer.commands)
+	if len(dialer.commands) != 2 || !strings.HasPrefix(dialer.commands[0], "labuser@localhost:2222") {
+		t.Errorf("dialer commands = %v, expected one per node", dialer.commands)
+	}
+}
+
+func TestCheckNodesRunsInParallelInNodeOrder(t *testing.T) {
+	app, rt, dialer, _ := newTestApp()
+	spec := defaultSpec(defaultLabName, 5)
+	dialer.delays = map[int]time.Duration{}
+	for i := 0; i < 5; i++ {
+		rt.addContainer(defaultLabName, fmt.Sprintf("lab-%02d", i+1), "running", 2222+i)
+		// Later nodes answer first
+		dialer.delays[2222+i] = time.Duration(5-i) * 40 * time.Millisecond
+	}
+	dialer.failures = map[int]error{2224: &SSHError{Reason: reasonTimeout, Err: errors.New("i/o timeout")}}
+	containers, _ := app.getContainers(context.Background(), spec)
+
+	start := time.Now()
+	var reported []string
+	checks := app.checkNodes(context.Background(), spec, containers, 5, func(check nodeCheck) {
+		reported = append(reported, check.Node)
+	})
+	elapsed := time.Since(start)
+
+	if strings.Join(reported, ",") != "lab-01,lab-02,lab-03,lab-04,lab-05" {
+		t.Errorf("reported order = %v, expected node order", reported)
+	}
+	if elapsed >= 400*time.Millisecond {
+		t.Errorf("checks took %s, expected them to overlap", elapsed)
+	}
+	if sshReason(checks[2].Err) != reasonTimeout || checks[0].Err != nil {
+		t.Errorf("checks = %+v, expected only lab-03 to time out", checks)
+	}
+	if checks[0].Duration < 200*time.Millisecond {
+		t.Errorf("lab-01 duration = %s, expected its 200ms latency", checks[0].Duration)
+	}
+}
+
+func TestTestConnectivityReportsLatency(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+
+	if err := app.testConnectivity(context.Background(), defaultSpec(defaultLabName, 1), testOptions{Parallel: 1}); err != nil {
+		t.Fatalf("testConnectivity unexpected error: %v", err)
+	}
+	if !regexp.MustCompile(`lab-01.*PASSED.* [0-9.]+[µm]?s`).MatchString(out.String()) {
+		t.Errorf("output missing latency for lab-01:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "All 1 connectivity tests passed") {
+		t.Errorf("output missing summary:\n%s", out.String())
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// copyPath is one side of a `lab cp`: a local path, or a path on the nodes
+// chosen by Selector
+type copyPath struct {
+	Selector string // node names, glob patterns or group:NAME; empty for a local path
+	Path     string
+}
+
+func (p copyPath) remote() bool {
+	return p.Selector != ""
+}
+
+// parseCopyPath splits "node:/path" and "group:web:/path" into selector and
+// path. Arguments without a colon, or that start like a local path, are local.
+func parseCopyPath(arg string) copyPath {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") || !strings.Contains(arg, ":") {
+		return copyPath{Path: arg}
+	}
+	if rest, ok := strings.CutPrefix(arg, "group:"); ok {
+		if group, remotePath, ok := strings.Cut(rest, ":"); ok {
+			return copyPath{Selector: "group:" + group, Path: remotePath}
+		}
+	}
+	selector, remotePath, _ := strings.Cut(arg, ":")
+	return copyPath{Selector: selector, Path: remotePath}
+}
+
+// copyStats counts what a copy transferred
+type copyStats struct {
+	Files int
+	Bytes int64
+}
+
+func (s copyStats) String() string {
+	return fmt.Sprintf("%d files, %s", s.Files, formatBytes(s.Bytes))
+}
+
+// copyFiles copies between the local machine and one or more nodes over SSH,
+// streaming a tar archive through the node's tar. Directories are copied
+// recursively with their permissions. When pulling from several nodes each
+// node's files land in a subdirectory named after the node.
+func (a *App) copyFiles(ctx context.Context, spec *LabSpec, srcArg, dstArg, user string) error {
+	src, dst := parseCopyPath(srcArg), parseCopyPath(dstArg)
+	switch {
+	case src.remote() && dst.remote():
+		return errors.New("copying between nodes is not supported - pull to a local directory first")
+	case !src.remote() && !dst.remote():
+		return errors.New("one side of lab cp must be on a node, e.g. lab-01:/path")
+	}
+	if _, ok := a.SSH.(shellRunner); !ok {
+		return errors.New("the SSH client does not support file transfers")
+	}
+
+	remote := src
+	if dst.remote() {
+		remote = dst
+	}
+	if remote.Path == "" {
+		return fmt.Errorf("%s: missing path after the node", remote.Selector)
+	}
+	nodes, group := remote.Selector, ""
+	if name, ok := strings.CutPrefix(remote.Selector, "group:"); ok {
+		nodes, group = "", name
+	}
+	containers, err := a.selectNodes(ctx, spec, nodes, group)
+	if err != nil {
+		return err
+	}
+
+	if dst.remote() {
+		if _, err := os.Lstat(src.Path); err != nil {
+			return err
+		}
+	}
+
+	var mu sync.Mutex
+	var failures []string
+	var wg sync.WaitGroup
+	for _, container := range containers {
+		node := spec.nodeName(container)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			target, err := a.nodeTarget(ctx, spec, node, user)
+			var stats copyStats
+			var from, to string
+			if err == nil {
+				if dst.remote() {
+					from, to = src.Path, node+":"+dst.Path
+					stats, err = a.pushFiles(ctx, target, src.Path, dst.Path)
+				} else {
+					localDst, rename := dst.Path, ""
+					if len(containers) > 1 {
+						localDst = filepath.Join(dst.Path, node)
+					} else if !isLocalDir(dst.Path) {
+						localDst, rename = filepath.Dir(dst.Path), filepath.Base(dst.Path)
+					}
+					from, to = node+":"+src.Path, localDst
+					stats, err = a.pullFiles(ctx, target, src.Path, localDst, rename)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s (%v)", node, err))
+				fmt.Fprintf(a.Out, "  %s %s %s\n", red("✗"), bold(node), err)
+				return
+			}
+			fmt.Fprintf(a.Out, "  %s %s %s → %s (%s)\n", green("✓"), bold(node), from, to, stats)
+		}()
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return fmt.Errorf("copy failed on %d of %d nodes: %s", len(failures), len(containers), strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// isLocalDir reports whether a local destination names a directory to copy into
+func isLocalDir(p string) bool {
+	if strings.HasSuffix(p, "/") {
+		return true
+	}
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
+
+// runRemote runs command on target with the given standard input and output,
+// turning a non-zero exit status into an error carrying its stderr
+func (a *App) runRemote(ctx context.Context, target SSHTarget, command string, stdin io.Reader, stdout io.Writer) error {
+	var stderr lockedBuffer
+	code, err := a.SSH.(shellRunner).Shell(ctx, target, ShellOptions{Command: command, Stdin: stdin, Stdout: stdout, Stderr: &stderr})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return errors.New(message)
+		}
+		return fmt.Errorf("%s exited with status %d", strings.Fields(command)[0], code)
+	}
+	return nil
+}
+
+// pushFiles copies the local src into dst on a node. Like cp, src goes inside
+// dst when dst is an existing directory or ends with a slash, and is copied as
+// dst otherwise.
+func (a *App) pushFiles(ctx context.Context, target SSHTarget, src, dst string) (copyStats, error) {
+	dir, name := dst, filepath.Base(src)
+	if !strings.HasSuffix(dst, "/") && a.runRemote(ctx, target, "test -d "+shellQuote(dst), nil, io.Discard) != nil {
+		dir, name = path.Dir(dst), path.Base(dst)
+	}
+
+	reader, writer := io.Pipe()
+	archived := make(chan copyStats, 1)
+	go func() {
+		stats, err := writeTar(writer, src, name)
+		writer.CloseWithError(err)
+		archived <- stats
+	}()
+
+	command := fmt.Sprintf("mkdir -p %s && tar -xpf - -C %s", shellQuote(dir), shellQuote(dir))
+	err := a.runRemote(ctx, target, command, reader, io.Discard)
+	reader.Close()
+	return <-archived, err
+}
+
+// pullFiles copies src from a node into the local directory dst, renaming
+// the copied file or directory when rename is set
+func (a *App) pullFiles(ctx context.Context, target SSHTarget, src, dst, rename string) (copyStats, error) {
+	src = strings.TrimSuffix(src, "/")
+	if src == "" {
+		src = "/"
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return copyStats{}, err
+	}
+
+	reader, writer := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		command := fmt.Sprintf("tar -cf - -C %s %s", shellQuote(path.Dir(src)), shellQuote(path.Base(src)))
+		err := a.runRemote(ctx, target, command, nil, writer)
+		writer.CloseWithError(err)
+		done <- err
+	}()
+
+	stats, err := extractTar(reader, dst, rename)
+	if err == nil {
+		// tar pads the archive past its end marker
+		io.Copy(io.Discard, reader)
+	}
+	reader.CloseWithError(err)
+	if remoteErr := <-done; remoteErr != nil {
+		return stats, remoteErr
+	}
+	return stats, err
+}
+
+// writeTar archives src, a file or directory tree, under name
+func writeTar(w io.Writer, src, name string) (copyStats, error) {
+	var stats copyStats
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(name, filepath.ToSlash(rel))
+		header.Uname, header.Gname = "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := io.Copy(tw, f)
+		stats.Files++
+		stats.Bytes += n
+		return err
+	})
+	if err != nil {
+		return stats, err
+	}
+	return stats, tw.Close()
+}
+
+// extractTar unpacks an archive into dir with the archived permissions. When
+// rename is set it replaces the first path component of every entry. Symlinks
+// must point inside dir, no entry is written through a symlink the archive
+// created, and every entry must resolve inside dir on disk, symlinks left by
+// earlier copies included, so a hostile node cannot write outside dir.
+func extractTar(r io.Reader, dir, rename string) (copyStats, error) {
+	var stats copyStats
+	links := map[string]bool{}
+	root, err := realPath(dir)
+	if err != nil {
+		return stats, err
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return stats, fmt.Errorf("refusing to extract %q outside %s", header.Name, dir)
+		}
+		if rename != "" {
+			_, rest, _ := strings.Cut(name, "/")
+			name = path.Join(rename, rest)
+		}
+		for prefix := name; prefix != "."; prefix = path.Dir(prefix) {
+			if links[prefix] {
+				return stats, fmt.Errorf("refusing to extract %q through the symlink %s", header.Name, prefix)
+			}
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		mode := os.FileMode(header.Mode).Perm()
+
+		// A symlink entry replaces target, anything else is written through it
+		check := target
+		if header.Typeflag == tar.TypeSymlink {
+			check = filepath.Dir(target)
+		}
+		real, err := realPath(check)
+		if err != nil || !insideDir(root, real) {
+			return stats, fmt.Errorf("refusing to extract %q through a symlink outside %s", header.Name, dir)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return stats, err
+			}
+			if err := os.Chmod(target, mode|0700); err != nil {
+				return stats, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return stats, err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+			if err != nil {
+				return stats, err
+			}
+			n, err := io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return stats, err
+			}
+			if err := os.Chmod(target, mode); err != nil {
+				return stats, err
+			}
+			os.Chtimes(target, header.ModTime, header.ModTime)
+			stats.Files++
+			stats.Bytes += n
+		case tar.TypeSymlink:
+			resolved := path.Join(path.Dir(name), header.Linkname)
+			if path.IsAbs(header.Linkname) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+				return stats, fmt.Errorf("refusing to extract symlink %q to %q outside %s", header.Name, header.Linkname, dir)
+			}
+			if linked, err := resolveLink(real, header.Linkname); err != nil || !insideDir(root, linked) {
+				return stats, fmt.Errorf("refusing to extract symlink %q to %q through a symlink outside %s", header.Name, header.Linkname, dir)
+			}
+			links[name] = true
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return stats, err
+			}
+			os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return stats, err
+			}
+		}
+	}
+}
+
+// realPath resolves the symlinks of p, whose last components may not exist yet
+func realPath(p string) (string, error) {
+	rest := ""
+	for {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		// A dangling symlink exists but does not resolve
+		if _, lerr := os.Lstat(p); lerr == nil || !errors.Is(err, os.ErrNotExist) || filepath.Dir(p) == p {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = filepath.Dir(p)
+	}
+}
+
+// resolveLink follows linkname from the real directory dir one component at a
+// time, so .. applies to where a symlink on the way really points
+func resolveLink(dir, linkname string) (string, error) {
+	current := dir
+	for _, part := range strings.Split(linkname, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			continue
+		}
+		current = filepath.Join(current, part)
+		if info, err := os.Lstat(current); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			real, err := realPath(current)
+			if err != nil {
+				return "", err
+			}
+			current = real
+		}
+	}
+	return current, nil
+}
+
+// insideDir reports whether p is root or below it
+func insideDir(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// formatBytes renders a size in B, KB, MB or GB
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// localNodes makes the dialer run copy commands with the local shell, each
+// node seeing its own temporary directory as /
+func localNodes(t *testing.T, dialer *fakeDialer, ports ...int) map[int]string {
+	roots := map[int]string{}
+	for _, port := range ports {
+		roots[port] = t.TempDir()
+	}
+	dialer.shell = func(target SSHTarget, opts ShellOptions) (int, error) {
+		command := strings.ReplaceAll(opts.Command, "'/", "'"+roots[target.Port]+"/")
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = opts.Stdin, opts.Stdout, opts.Stderr
+		err := cmd.Run()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode(), nil
+		}
+		return 0, err
+	}
+	return roots
+}
+
+func writeTestFile(t *testing.T, file, content string, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(file, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyFilesPushesDirectoryWithPermissions(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar is not installed")
+	}
+	app, rt, dialer, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	roots := localNodes(t, dialer, 2222, 2223)
+	for _, root := range roots {
+		os.MkdirAll(filepath.Join(root, "etc/app"), 0755)
+	}
+
+	src := filepath.Join(t.TempDir(), "configs")
+	writeTestFile(t, filepath.Join(src, "app.conf"), "port=80\n", 0640)
+	writeTestFile(t, filepath.Join(src, "bin/run.sh"), "#!/bin/sh\n", 0750)
+
+	if err := app.copyFiles(context.Background(), defaultSpec(defaultLabName, 2), src, "lab-0*:/etc/app", ""); err != nil {
+		t.Fatalf("copyFiles failed: %v\n%s", err, out)
+	}
+	for port, root := range roots {
+		for file, mode := range map[string]os.FileMode{"configs/app.conf": 0640, "configs/bin/run.sh": 0750} {
+			info, err := os.Stat(filepath.Join(root, "etc/app", file))
+			if err != nil {
+				t.Errorf("port %d: %v", port, err)
+				continue
+			}
+			if info.Mode().Perm() != mode {
+				t.Errorf("port %d: %s has mode %v, expected %v", port, file, info.Mode().Perm(), mode)
+			}
+		}
+	}
+	if !strings.Contains(out.String(), "(2 files, 18 B)") {
+		t.Errorf("output should report what was copied:\n%s", out)
+	}
+}
+
+func TestCopyFilesPullsIntoNodeDirectories(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar is not installed")
+	}
+	app, rt, dialer, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	rt.addContainer(defaultLabName, "lab-03", "running", 2224)
+	roots := localNodes(t, dialer, 2222, 2223, 2224)
+	writeTestFile(t, filepath.Join(roots[2222], "var/log/app.log"), "one\n", 0644)
+	writeTestFile(t, filepath.Join(roots[2223], "var/log/app.log"), "two\n", 0644)
+	spec := defaultSpec(defaultLabName, 3)
+	spec.Groups = map[string]GroupSpec{"web": {Hosts: []string{"lab-01", "lab-02"}}}
+
+	dst := filepath.Join(t.TempDir(), "logs")
+	if err := app.copyFiles(context.Background(), spec, "group:web:/var/log/app.log", dst+"/", ""); err != nil {
+		t.Fatalf("copyFiles failed: %v\n%s", err, out)
+	}
+	for node, expected := range map[string]string{"lab-01": "one\n", "lab-02": "two\n"} {
+		data, err := os.ReadFile(filepath.Join(dst, node, "app.log"))
+		if err != nil || string(data) != expected {
+			t.Errorf("%s/app.log = %q, %v; expected %q", node, data, err, expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "lab-03")); err == nil {
+		t.Error("lab-03 is not in the group and should not be copied from")
+	}
+
+	err := app.copyFiles(context.Background(), spec, "lab-0[23]:/var/log/app.log", dst, "")
+	if err == nil || !strings.Contains(err.Error(), "copy failed on 1 of 2 nodes: lab-03") {
+		t.Errorf("copyFiles error = %v, expected lab-03 to fail", err)
+	}
+}
+
+func TestCopyFilesPullsSingleFileUnderNewName(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar is not installed")
+	}
+	app, rt, dialer, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	roots := localNodes(t, dialer, 2222)
+	writeTestFile(t, filepath.Join(roots[2222], "etc/hosts"), "127.0.0.1 localhost\n", 0644)
+
+	dst := filepath.Join(t.TempDir(), "lab-01.hosts")
+	if err := app.copyFiles(context.Background(), defaultSpec(defaultLabName, 1), "lab-01:/etc/hosts", dst, ""); err != nil {
+		t.Fatalf("copyFiles failed: %v\n%s", err, out)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "127.0.0.1 localhost\n" {
+		t.Errorf("%s = %q, %v", dst, data, err)
+	}
+}
+
+func TestParseCopyPath(t *testing.T) {
+	tests := []struct {
+		arg      string
+		expected copyPath
+	}{
+		{"./configs", copyPath{Path: "./configs"}},
+		{"/tmp/a:b", copyPath{Path: "/tmp/a:b"}},
+		{"logs", copyPath{Path: "logs"}},
+		{"lab-01:/etc/app", copyPath{Selector: "lab-01", Path: "/etc/app"}},
+		{"lab-0*:/etc/app", copyPath{Selector: "lab-0*", Path: "/etc/app"}},
+		{"group:web:/var/log/app.log", copyPath{Selector: "group:web", Path: "/var/log/app.log"}},
+		{"lab-01:", copyPath{Selector: "lab-01"}},
+	}
+	for _, test := range tests {
+		if got := parseCopyPath(test.arg); got != test.expected {
+			t.Errorf("parseCopyPath(%q) = %+v, expected %+v", test.arg, got, test.expected)
+		}
+	}
+}
+
+func TestCopyFilesRejectsBadArguments(t *testing.T) {
+	app, _, _, _ := newTestApp()
+	spec := defaultSpec(defaultLabName, 2)
+	for _, args := range [][2]string{{"./a", "./b"}, {"lab-01:/a", "lab-02:/b"}, {"./a", "lab-01:"}} {
+		if err := app.copyFiles(context.Background(), spec, args[0], args[1], ""); err == nil {
+			t.Errorf("copyFiles(%q, %q) should fail", args[0], args[1])
+		}
+	}
+}
+
+func TestExtractTarRejectsPathsOutsideDestination(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+
+	dir := t.TempDir()
+	if _, err := extractTar(&archive, filepath.Join(dir, "dst"), ""); err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Errorf("extractTar error = %v, expected it to refuse ../escape", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape")); err == nil {
+		t.Error("extractTar wrote outside the destination")
+	}
+}
+
+func TestExtractTarRejectsSymlinkEscapes(t *testing.T) {
+	for name, entries := range map[string][]tar.Header{
+		"absolute link": {{Name: "link", Linkname: "/etc", Typeflag: tar.TypeSymlink}},
+		"relative link": {{Name: "sub/link", Linkname: "../../..", Typeflag: tar.TypeSymlink}},
+		"write through link": {
+			{Name: "link", Linkname: "sub", Typeflag: tar.TypeSymlink},
+			{Name: "link/passwd", Mode: 0644, Size: 1, Typeflag: tar.TypeReg},
+		},
+	} {
+		var archive bytes.Buffer
+		tw := tar.NewWriter(&archive)
+		for _, header := range entries {
+			tw.WriteHeader(&header)
+			if header.Size > 0 {
+				tw.Write([]byte("x"))
+			}
+		}
+		tw.Close()
+
+		dst := filepath.Join(t.TempDir(), "dst")
+		if _, err := extractTar(&archive, dst, ""); err == nil || !strings.Contains(err.Error(), "refusing") {
+			t.Errorf("%s: extractTar error = %v, expected it to be refused", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dst, "sub", "passwd")); err == nil {
+			t.Errorf("%s: extractTar wrote through a symlink", name)
+		}
+	}
+}
+
+func TestExtractTarRejectsEscapesThroughExistingSymlinks(t *testing.T) {
+	extract := func(dst string, entries ...tar.Header) error {
+		var archive bytes.Buffer
+		tw := tar.NewWriter(&archive)
+		for _, header := range entries {
+			tw.WriteHeader(&header)
+			if header.Size > 0 {
+				tw.Write([]byte("x"))
+			}
+		}
+		tw.Close()
+		_, err := extractTar(&archive, dst, "")
+		return err
+	}
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "dst")
+
+	// b -> a/.. is dst lexically, but a -> . makes it the parent of dst on disk
+	if err := extract(dst, tar.Header{Name: "a", Linkname: ".", Typeflag: tar.TypeSymlink}); err != nil {
+		t.Fatalf("first pull unexpected error: %v", err)
+	}
+	err := extract(dst, tar.Header{Name: "b", Linkname: "a/..", Typeflag: tar.TypeSymlink})
+	if err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Errorf("second pull error = %v, expected b -> a/.. to be refused", err)
+	}
+
+	// A link that escapes, however it got there, is never written through
+	os.Remove(filepath.Join(dst, "b"))
+	os.Symlink("..", filepath.Join(dst, "b"))
+	err = extract(dst, tar.Header{Name: "b/evil", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	if err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Errorf("pull through b error = %v, expected it to be refused", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "evil")); err == nil {
+		t.Error("extractTar wrote outside the destination through an existing symlink")
+	}
+}
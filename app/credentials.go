@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// passwordAlphabet avoids characters that need quoting in shells, YAML or INI files
+const passwordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// passwordLength gives generated passwords about 116 bits of entropy
+const passwordLength = 20
+
+// hiddenSecret replaces passwords in output unless --show-secrets is given
+const hiddenSecret = "********"
+
+// randomPassword returns a password drawn from crypto/rand
+func randomPassword() string {
+	size := big.NewInt(int64(len(passwordAlphabet)))
+	password := make([]byte, passwordLength)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			panic(fmt.Sprintf("crypto/rand failed: %v", err))
+		}
+		password[i] = passwordAlphabet[n.Int64()]
+	}
+	return string(password)
+}
+
+// applyCredentials replaces the passwords generated for a spec that does not
+// set them with the ones recorded for its lab, so they stay the same for the
+// lifetime of the lab
+func applyCredentials(spec *LabSpec, state *LabState) {
+	if spec.User.generatedPassword && state.Credentials.Password != "" {
+		spec.User.Password = state.Credentials.Password
+	}
+	if spec.User.generatedRootPassword && state.Credentials.RootPassword != "" {
+		spec.User.RootPassword = state.Credentials.RootPassword
+	}
+}
+
+// secret returns value when secrets are shown and a placeholder otherwise
+func (a *App) secret(value string) string {
+	if a.ShowSecrets {
+		return value
+	}
+	return hiddenSecret
+}
+
+// showCredentials prints the lab's credentials. With rotate it first sets new
+// random passwords in every node and records them in the lab state.
+func (a *App) showCredentials(ctx context.Context, spec *LabSpec, rotate bool) error {
+	fmt.Fprintf(a.errOut(), "\n%s %s\n", cyan("🔐"), bold("Lab Credentials"))
+	fmt.Fprintf(a.errOut(), "%s\n", blue("═══════════════════════"))
+
+	state, err := a.loadState(spec.Name)
+	if err != nil {
+		return err
+	}
+	if state.Created.IsZero() {
+		return fmt.Errorf("lab %s has not been initialized - run ./lab init first", spec.Name)
+	}
+	if rotate {
+		if err := a.rotateCredentials(ctx, spec, state); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(a.Out, "user: %s\n", state.Credentials.User)
+	fmt.Fprintf(a.Out, "password: %s\n", state.Credentials.Password)
+	fmt.Fprintf(a.Out, "root_password: %s\n", state.Credentials.RootPassword)
+	if spec.keyFile != "" {
+		fmt.Fprintf(a.Out, "ssh_key: %s\n", spec.keyFile)
+	}
+	return nil
+}
+
+// configuredMarker is the file entrypoint.sh creates once the lab user exists
+const configuredMarker = "/var/lib/lab/configured"
+
+// chpasswdCommand sets the passwords of accounts inside a node. With wait set
+// it first waits, up to a minute, for the entrypoint to create the lab user.
+func chpasswdCommand(passwords map[string]string, wait bool) []string {
+	var lines []string
+	for _, account := range sortedKeys(passwords) {
+		lines = append(lines, account+":"+passwords[account])
+	}
+	script := fmt.Sprintf("printf '%%s\\n' %s | chpasswd", strings.Join(lines, " "))
+	if wait {
+		script = fmt.Sprintf("for i in $(seq 300); do [ -f %s ] && break; sleep 0.2; done; %s", configuredMarker, script)
+	}
+	return []string{"sh", "-c", script}
+}
+
+// setPasswords sets the lab passwords on newly created nodes, given by node
+// name with their container IDs. They are set
+// with chpasswd rather than passed in the container env, where anyone who can
+// inspect the container could read them. Restarted nodes keep their passwords.
+func (a *App) setPasswords(ctx context.Context, spec *LabSpec, ids map[string]string) error {
+	passwords := map[string]string{}
+	if spec.User.Password != "" {
+		passwords[spec.User.Name] = spec.User.Password
+	}
+	if spec.User.RootPassword != "" {
+		passwords["root"] = spec.User.RootPassword
+	}
+	if len(passwords) == 0 || len(ids) == 0 {
+		return nil
+	}
+
+	command := chpasswdCommand(passwords, true)
+	for _, node := range sortedKeys(ids) {
+		var stderr lockedBuffer
+		code, err := a.Runtime.Exec(ctx, ids[node], command, nil, &stderr)
+		if err == nil && code != 0 {
+			err = errors.New(strings.TrimSpace(stderr.String()))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set the passwords of %s: %w", node, err)
+		}
+	}
+	return nil
+}
+
+// rotateCredentials sets new passwords on every node of a running lab. Only
+// generated passwords are rotated; passwords set in the spec are kept.
+func (a *App) rotateCredentials(ctx context.Context, spec *LabSpec, state *LabState) error {
+	accounts := map[string]*string{}
+	if spec.User.generatedPassword {
+		accounts[spec.User.Name] = &state.Credentials.Password
+	}
+	if spec.User.generatedRootPassword {
+		accounts["root"] = &state.Credentials.RootPassword
+	}
+	if len(accounts) == 0 {
+		return fmt.Errorf("the passwords are set in %s - change them there and run ./lab init", spec.source)
+	}
+
+	containers, err := a.Runtime.ListContainers(ctx, ListOptions{All: true, Labels: roleLabels(spec, roleNode)})
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return errNoContainers
+	}
+	for _, container := range containers {
+		if !container.Running() {
+			return fmt.Errorf("%s is not running - start the lab first so every node gets the new passwords", container.Name)
+		}
+	}
+
+	passwords := map[string]string{}
+	for account := range accounts {
+		passwords[account] = randomPassword()
+	}
+	command := chpasswdCommand(passwords, false)
+
+	var failures []string
+	for _, container := range containers {
+		var stderr lockedBuffer
+		code, err := a.Runtime.Exec(ctx, container.ID, command, nil, &stderr)
+		if err == nil && code != 0 {
+			err = errors.New(strings.TrimSpace(stderr.String()))
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s (%v)", spec.nodeName(container), err))
+			continue
+		}
+		fmt.Fprintf(a.errOut(), "  %s %s passwords rotated\n", green("✓"), bold(spec.nodeName(container)))
+	}
+
+	// Record what the nodes now use, even when some of them failed
+	if len(failures) < len(containers) {
+		for account, password := range passwords {
+			*accounts[account] = password
+		}
+		if err := a.saveState(state); err != nil {
+			return err
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("rotation failed on %d of %d nodes: %s", len(failures), len(containers), strings.Join(failures, ", "))
+	}
+	fmt.Fprintf(a.errOut(), "%s Passwords rotated on all %d nodes\n", green("✅"), len(containers))
+	return nil
+}
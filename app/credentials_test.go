@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedCredentialsLastForTheLab(t *testing.T) {
+	app, _, _, _ := newTestApp()
+	app.StateDir = t.TempDir()
+	spec := defaultSpec(defaultLabName, 2)
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+
+	loaded := defaultSpec(defaultLabName, 2)
+	if loaded.User.Password == spec.User.Password {
+		t.Fatalf("every spec should start with fresh random passwords")
+	}
+	if specHash(loaded) != specHash(spec) {
+		t.Errorf("generated passwords should not change the spec hash")
+	}
+	if err := app.applyState(loaded); err != nil {
+		t.Fatalf("applyState unexpected error: %v", err)
+	}
+	if loaded.User.Password != spec.User.Password || loaded.User.RootPassword != spec.User.RootPassword {
+		t.Errorf("credentials = %+v, expected the ones recorded by init", loaded.User)
+	}
+
+	// Passwords set in the spec win over recorded ones
+	fixed := defaultSpec(defaultLabName, 2)
+	fixed.User.Password, fixed.User.generatedPassword = "chosen", false
+	if err := app.applyState(fixed); err != nil {
+		t.Fatalf("applyState unexpected error: %v", err)
+	}
+	if fixed.User.Password != "chosen" || fixed.User.RootPassword != spec.User.RootPassword {
+		t.Errorf("credentials = %+v, expected the spec password and the recorded root password", fixed.User)
+	}
+}
+
+func TestConnectionDetailsHideSecrets(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	spec := defaultSpec(defaultLabName, 1)
+
+	if err := app.showStatus(context.Background(), spec, "", ""); err != nil {
+		t.Fatalf("showStatus unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), spec.User.Password) || strings.Contains(out.String(), spec.User.RootPassword) {
+		t.Errorf("status should hide the passwords:\n%s", out)
+	}
+
+	out.Reset()
+	app.ShowSecrets = true
+	if err := app.showStatus(context.Background(), spec, "", ""); err != nil {
+		t.Fatalf("showStatus unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Password: "+spec.User.Password) || !strings.Contains(out.String(), spec.User.RootPassword) {
+		t.Errorf("status --show-secrets should show the passwords:\n%s", out)
+	}
+}
+
+func TestRotateCredentials(t *testing.T) {
+	app, rt, _, _ := newTestApp()
+	app.StateDir = t.TempDir()
+	spec := defaultSpec(defaultLabName, 2)
+	spec.User.RootPassword, spec.User.generatedRootPassword = "fixed-root", false
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+
+	var commands []string
+	rt.exec = func(name string, cmd []string, stdout, stderr io.Writer) (int, error) {
+		commands = append(commands, name+" "+strings.Join(cmd, " "))
+		return 0, nil
+	}
+	var stdout bytes.Buffer
+	app.Out = &stdout
+	if err := app.showCredentials(context.Background(), spec, true); err != nil {
+		t.Fatalf("showCredentials --rotate unexpected error: %v", err)
+	}
+
+	state, _ := app.loadState(defaultLabName)
+	if state.Credentials.Password == spec.User.Password || len(state.Credentials.Password) != passwordLength {
+		t.Errorf("user password was not rotated: %q", state.Credentials.Password)
+	}
+	if state.Credentials.RootPassword != "fixed-root" {
+		t.Errorf("root password = %q, the password set in the spec should be kept", state.Credentials.RootPassword)
+	}
+	if len(commands) != 2 || !strings.Contains(commands[0], "labuser:"+state.Credentials.Password+" | chpasswd") || strings.Contains(commands[0], "root:") {
+		t.Errorf("commands = %q, expected chpasswd of the lab user on both nodes", commands)
+	}
+	if !strings.Contains(stdout.String(), "password: "+state.Credentials.Password+"\n") {
+		t.Errorf("credentials output should show the new password:\n%s", stdout.String())
+	}
+}
+
+func TestInitSetsPasswordsOutsideTheEnv(t *testing.T) {
+	app, rt, _, _ := newTestApp()
+	spec := defaultSpec(defaultLabName, 2)
+
+	for _, env := range nodeContainerConfig(spec, spec.Nodes[0]).Env {
+		if strings.Contains(env, spec.User.Password) || strings.Contains(env, spec.User.RootPassword) {
+			t.Errorf("env %q should not carry a password", env)
+		}
+	}
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+	for _, node := range []string{"lab-01", "lab-02"} {
+		if !rt.called("exec " + node + " sh -c for i in $(seq 300); do [ -f " + configuredMarker + " ]") {
+			t.Errorf("expected %s to wait for its entrypoint, got %v", node, rt.calls)
+		}
+	}
+	expected := "labuser:" + spec.User.Password + " root:" + spec.User.RootPassword + " | chpasswd"
+	if !strings.Contains(strings.Join(rt.calls, "\n"), expected) {
+		t.Errorf("expected %q, got %v", expected, rt.calls)
+	}
+
+	// Restarted nodes keep the passwords they have
+	rt.calls = nil
+	if err := app.startLab(context.Background(), spec); err != nil {
+		t.Fatalf("startLab unexpected error: %v", err)
+	}
+	if rt.called("exec") {
+		t.Errorf("startLab should not set passwords on existing nodes: %v", rt.calls)
+	}
+}
@@ -0,0 +1,756 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dockerAPIVersion is the Engine API version requested; 1.41 is Docker 20.10+
+	dockerAPIVersion  = "v1.41"
+	defaultDockerHost = "unix:///var/run/docker.sock"
+)
+
+// dockerClient talks to the Docker Engine API over the unix socket or TCP.
+// Podman serves the same API, so it is also used for the podman runtime.
+type dockerClient struct {
+	name    string
+	http    *http.Client
+	baseURL string
+}
+
+var _ Runtime = (*dockerClient)(nil)
+
+// apiError is an error response returned by the Engine API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// isNotFound reports whether err is a 404 from the Engine API
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// newDockerClient creates a client for host, which uses the DOCKER_HOST syntax.
+// An empty host falls back to DOCKER_HOST and then to the default unix socket.
+func newDockerClient(host string) (*dockerClient, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultDockerHost
+	}
+
+	return newEngineClient("docker", host)
+}
+
+// newPodmanClient creates a client for Podman's Docker-compatible API. An empty
+// host falls back to CONTAINER_HOST and then to the rootless and rootful sockets.
+func newPodmanClient(host string) (*dockerClient, error) {
+	if host == "" {
+		host = podmanHost()
+	}
+	if host == "" {
+		return nil, fmt.Errorf("no Podman API socket found - start it with: systemctl --user start podman.socket")
+	}
+	return newEngineClient("podman", host)
+}
+
+// podmanHost returns the Podman API socket in use, or "" when none is available
+func podmanHost() string {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+
+	sockets := []string{"/run/podman/podman.sock"}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		sockets = append([]string{filepath.Join(runtimeDir, "podman", "podman.sock")}, sockets...)
+	}
+	for _, socket := range sockets {
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket
+		}
+	}
+	return ""
+}
+
+func newEngineClient(name, host string) (*dockerClient, error) {
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s host %q: %w", name, host, err)
+	}
+
+	transport := &http.Transport{}
+	client := &dockerClient{name: name, http: &http.Client{Transport: transport}}
+
+	switch hostURL.Scheme {
+	case "unix":
+		socket := hostURL.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		client.baseURL = "http://docker"
+	case "tcp":
+		client.baseURL = "http://" + hostURL.Host
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			tlsConfig, err := dockerTLSConfig(os.Getenv("DOCKER_CERT_PATH"))
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsConfig
+			client.baseURL = "https://" + hostURL.Host
+		}
+	default:
+		return nil, fmt.Errorf("unsupported %s host %q (only unix:// and tcp:// are supported)", name, host)
+	}
+
+	return client, nil
+}
+
+// Name identifies the backend in messages
+func (c *dockerClient) Name() string {
+	return c.name
+}
+
+// dockerTLSConfig loads the client certificates the docker CLI uses for DOCKER_TLS_VERIFY
+func dockerTLSConfig(certPath string) (*tls.Config, error) {
+	if certPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		certPath = filepath.Join(home, ".docker")
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load docker client certificate: %w", err)
+	}
+	caData, err := os.ReadFile(filepath.Join(certPath, "ca.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load docker CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caData)
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool}, nil
+}
+
+// request sends an API request and returns the response; callers must close the body.
+// body is sent as JSON unless it is an io.Reader, which is streamed as-is.
+func (c *dockerClient) request(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader = b
+		contentType = "application/x-tar"
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	endpoint := c.baseURL + "/" + dockerAPIVersion + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the %s API: %w", c.name, err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var message struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &apiError{StatusCode: resp.StatusCode, Message: message.Message}
+	}
+	return resp, nil
+}
+
+// call sends an API request and decodes the JSON response into out when it is not nil
+func (c *dockerClient) call(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.request(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// filterQuery encodes Engine API list filters
+func filterQuery(filters map[string][]string) url.Values {
+	query := url.Values{}
+	if len(filters) > 0 {
+		data, _ := json.Marshal(filters)
+		query.Set("filters", string(data))
+	}
+	return query
+}
+
+type dockerPort struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+type dockerContainerSummary struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	State   string            `json:"State"`
+	Status  string            `json:"Status"`
+	Labels  map[string]string `json:"Labels"`
+	Ports   []dockerPort      `json:"Ports"`
+	Created int64             `json:"Created"`
+}
+
+func (s dockerContainerSummary) container() Container {
+	container := Container{
+		ID:      s.ID,
+		Image:   s.Image,
+		State:   s.State,
+		Status:  s.Status,
+		Labels:  s.Labels,
+		Created: time.Unix(s.Created, 0),
+	}
+	if len(s.Names) > 0 {
+		container.Name = strings.TrimPrefix(s.Names[0], "/")
+	}
+	for _, port := range s.Ports {
+		container.Ports = append(container.Ports, PortBinding{
+			HostIP:        port.IP,
+			HostPort:      port.PublicPort,
+			ContainerPort: port.PrivatePort,
+			Protocol:      port.Type,
+		})
+	}
+	return container
+}
+
+// ListContainers returns containers matching opts
+func (c *dockerClient) ListContainers(ctx context.Context, opts ListOptions) ([]Container, error) {
+	filters := map[string][]string{}
+	if opts.Name != "" {
+		filters["name"] = []string{opts.Name}
+	}
+	if len(opts.Labels) > 0 {
+		filters["label"] = labelFilters(opts.Labels)
+	}
+	query := filterQuery(filters)
+	if opts.All {
+		query.Set("all", "1")
+	}
+
+	var summaries []dockerContainerSummary
+	if err := c.call(ctx, http.MethodGet, "/containers/json", query, nil, &summaries); err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0, len(summaries))
+	for _, summary := range summaries {
+		containers = append(containers, summary.container())
+	}
+	return containers, nil
+}
+
+type dockerContainerInspect struct {
+	ID      string `json:"Id"`
+	Name    string `json:"Name"`
+	Created string `json:"Created"`
+	State   struct {
+		Status  string `json:"Status"`
+		Running bool   `json:"Running"`
+	} `json:"State"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+	} `json:"NetworkSettings"`
+}
+
+func (i dockerContainerInspect) container() Container {
+	container := Container{
+		ID:     i.ID,
+		Name:   strings.TrimPrefix(i.Name, "/"),
+		Image:  i.Config.Image,
+		State:  i.State.Status,
+		Status: i.State.Status,
+		Labels: i.Config.Labels,
+	}
+	if i.State.Running {
+		container.Status = "Up"
+	}
+	container.Created, _ = time.Parse(time.RFC3339Nano, i.Created)
+
+	for key, bindings := range i.NetworkSettings.Ports {
+		portPart, proto, _ := strings.Cut(key, "/")
+		containerPort, _ := strconv.Atoi(portPart)
+		for _, binding := range bindings {
+			hostPort, _ := strconv.Atoi(binding.HostPort)
+			container.Ports = append(container.Ports, PortBinding{
+				HostIP:        binding.HostIP,
+				HostPort:      hostPort,
+				ContainerPort: containerPort,
+				Protocol:      proto,
+			})
+		}
+	}
+	return container
+}
+
+// InspectContainer returns a single container by name or ID
+func (c *dockerClient) InspectContainer(ctx context.Context, id string) (Container, error) {
+	var inspect dockerContainerInspect
+	if err := c.call(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil, nil, &inspect); err != nil {
+		return Container{}, err
+	}
+	return inspect.container(), nil
+}
+
+// CreateContainer creates a container and attaches it to all of its networks
+func (c *dockerClient) CreateContainer(ctx context.Context, config ContainerConfig) (string, error) {
+	exposed := map[string]struct{}{}
+	bindings := map[string][]map[string]string{}
+	for _, port := range config.Ports {
+		key := fmt.Sprintf("%d/%s", port.ContainerPort, port.Protocol)
+		exposed[key] = struct{}{}
+		bindings[key] = append(bindings[key], map[string]string{
+			"HostIp":   port.HostIP,
+			"HostPort": strconv.Itoa(port.HostPort),
+		})
+	}
+
+	mounts := []map[string]string{}
+	for _, mount := range config.Mounts {
+		mounts = append(mounts, map[string]string{"Type": "volume", "Source": mount.Volume, "Target": mount.Target})
+	}
+
+	hostConfig := map[string]interface{}{
+		"PortBindings":  bindings,
+		"Mounts":        mounts,
+		"RestartPolicy": map[string]string{"Name": config.RestartPolicy},
+	}
+	if len(config.Networks) > 0 {
+		hostConfig["NetworkMode"] = config.Networks[0]
+	}
+
+	body := map[string]interface{}{
+		"Image":        config.Image,
+		"Hostname":     config.Hostname,
+		"Env":          config.Env,
+		"Labels":       config.Labels,
+		"ExposedPorts": exposed,
+		"HostConfig":   hostConfig,
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	query := url.Values{"name": {config.Name}}
+	if err := c.call(ctx, http.MethodPost, "/containers/create", query, body, &created); err != nil {
+		return "", err
+	}
+
+	// Only one network can be set at creation time, the rest are connected afterwards
+	for _, network := range config.Networks[min(1, len(config.Networks)):] {
+		connect := map[string]string{"Container": created.ID}
+		if err := c.call(ctx, http.MethodPost, "/networks/"+url.PathEscape(network)+"/connect", nil, connect, nil); err != nil {
+			return created.ID, fmt.Errorf("failed to connect %s to %s: %w", config.Name, network, err)
+		}
+	}
+	return created.ID, nil
+}
+
+// StartContainer starts a container; starting a running container is not an error
+func (c *dockerClient) StartContainer(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil, nil, nil)
+}
+
+// StopContainer stops a container, killing it after timeout
+func (c *dockerClient) StopContainer(ctx context.Context, id string, timeout time.Duration) error {
+	query := url.Values{"t": {strconv.Itoa(int(timeout.Seconds()))}}
+	return c.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/stop", query, nil, nil)
+}
+
+// RemoveContainer force-removes a container, leaving its named volumes in place
+func (c *dockerClient) RemoveContainer(ctx context.Context, id string) error {
+	query := url.Values{"force": {"1"}}
+	return c.call(ctx, http.MethodDelete, "/containers/"+url.PathEscape(id), query, nil, nil)
+}
+
+// Exec runs cmd in a running container and returns its exit code
+func (c *dockerClient) Exec(ctx context.Context, id string, cmd []string, stdout, stderr io.Writer) (int, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	body := map[string]interface{}{"Cmd": cmd, "AttachStdout": true, "AttachStderr": true}
+	if err := c.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/exec", nil, body, &created); err != nil {
+		return -1, err
+	}
+
+	resp, err := c.request(ctx, http.MethodPost, "/exec/"+created.ID+"/start", nil, map[string]bool{"Detach": false, "Tty": false})
+	if err != nil {
+		return -1, err
+	}
+	err = demuxStream(resp.Body, stdout, stderr)
+	resp.Body.Close()
+	if err != nil {
+		return -1, err
+	}
+
+	var inspect struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/exec/"+created.ID+"/json", nil, nil, &inspect); err != nil {
+		return -1, err
+	}
+	return inspect.ExitCode, nil
+}
+
+// ContainerLogs streams the container's output with timestamps
+func (c *dockerClient) ContainerLogs(ctx context.Context, id string, opts LogOptions, stdout, stderr io.Writer) error {
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}, "timestamps": {"1"}}
+	if opts.Follow {
+		query.Set("follow", "1")
+	}
+	if !opts.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+
+	resp, err := c.request(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = demuxStream(resp.Body, stdout, stderr)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// demuxStream splits the engine's multiplexed stdout/stderr stream. Each frame
+// has an 8 byte header: the stream type, three padding bytes and a big endian size.
+func demuxStream(stream io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(stream, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		out := stdout
+		if header[0] == 2 {
+			out = stderr
+		}
+		if out == nil {
+			out = io.Discard
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(out, stream, size); err != nil {
+			return err
+		}
+	}
+}
+
+type dockerNetwork struct {
+	ID     string            `json:"Id"`
+	Name   string            `json:"Name"`
+	Labels map[string]string `json:"Labels"`
+	IPAM   struct {
+		Config []struct {
+			Subnet string `json:"Subnet"`
+		} `json:"Config"`
+	} `json:"IPAM"`
+}
+
+func (n dockerNetwork) network() Network {
+	network := Network{ID: n.ID, Name: n.Name, Labels: n.Labels}
+	for _, config := range n.IPAM.Config {
+		if config.Subnet != "" {
+			network.Subnets = append(network.Subnets, config.Subnet)
+		}
+	}
+	return network
+}
+
+// ListNetworks returns networks matching opts
+func (c *dockerClient) ListNetworks(ctx context.Context, opts ListOptions) ([]Network, error) {
+	filters := map[string][]string{}
+	if opts.Name != "" {
+		filters["name"] = []string{opts.Name}
+	}
+	if len(opts.Labels) > 0 {
+		filters["label"] = labelFilters(opts.Labels)
+	}
+
+	var raw []dockerNetwork
+	if err := c.call(ctx, http.MethodGet, "/networks", filterQuery(filters), nil, &raw); err != nil {
+		return nil, err
+	}
+
+	networks := make([]Network, 0, len(raw))
+	for _, network := range raw {
+		networks = append(networks, network.network())
+	}
+	return networks, nil
+}
+
+// CreateNetwork creates a bridge network, optionally with a fixed subnet
+func (c *dockerClient) CreateNetwork(ctx context.Context, name, subnet string, labels map[string]string) error {
+	body := map[string]interface{}{
+		"Name":           name,
+		"Driver":         "bridge",
+		"Labels":         labels,
+		"CheckDuplicate": true,
+	}
+	if subnet != "" {
+		body["IPAM"] = map[string]interface{}{
+			"Config": []map[string]string{{"Subnet": subnet}},
+		}
+	}
+	return c.call(ctx, http.MethodPost, "/networks/create", nil, body, nil)
+}
+
+// RemoveNetwork removes a network by name or ID
+func (c *dockerClient) RemoveNetwork(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, "/networks/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// ListVolumes returns volumes matching opts
+func (c *dockerClient) ListVolumes(ctx context.Context, opts ListOptions) ([]Volume, error) {
+	filters := map[string][]string{}
+	if opts.Name != "" {
+		filters["name"] = []string{opts.Name}
+	}
+	if len(opts.Labels) > 0 {
+		filters["label"] = labelFilters(opts.Labels)
+	}
+
+	var raw struct {
+		Volumes []struct {
+			Name   string            `json:"Name"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Volumes"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/volumes", filterQuery(filters), nil, &raw); err != nil {
+		return nil, err
+	}
+
+	volumes := make([]Volume, 0, len(raw.Volumes))
+	for _, v := range raw.Volumes {
+		volumes = append(volumes, Volume{Name: v.Name, Labels: v.Labels})
+	}
+	return volumes, nil
+}
+
+// CreateVolume creates a named volume; creating an existing volume is not an error
+func (c *dockerClient) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	body := map[string]interface{}{"Name": name, "Labels": labels}
+	return c.call(ctx, http.MethodPost, "/volumes/create", nil, body, nil)
+}
+
+// RemoveVolume removes a named volume
+func (c *dockerClient) RemoveVolume(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, "/volumes/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// ImageExists reports whether ref is present locally
+func (c *dockerClient) ImageExists(ctx context.Context, ref string) (bool, error) {
+	err := c.call(ctx, http.MethodGet, "/images/"+ref+"/json", nil, nil, nil)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ImageID returns the ID of the local image ref
+func (c *dockerClient) ImageID(ctx context.Context, ref string) (string, error) {
+	var image struct {
+		ID string `json:"Id"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/images/"+ref+"/json", nil, nil, &image); err != nil {
+		return "", err
+	}
+	return image.ID, nil
+}
+
+// ImageLabels returns the labels of the local image ref
+func (c *dockerClient) ImageLabels(ctx context.Context, ref string) (map[string]string, error) {
+	var image struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/images/"+ref+"/json", nil, nil, &image); err != nil {
+		return nil, err
+	}
+	return image.Config.Labels, nil
+}
+
+// BuildImage builds contextDir (which must contain a Dockerfile) and tags the result as tag
+func (c *dockerClient) BuildImage(ctx context.Context, contextDir, tag string, labels map[string]string) error {
+	archive := tarDirectory(contextDir)
+	defer archive.Close()
+
+	encodedLabels, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"t": {tag}, "rm": {"1"}, "labels": {string(encodedLabels)}}
+	resp, err := c.request(ctx, http.MethodPost, "/build", query, archive)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return readProgress(resp.Body)
+}
+
+// PullImage pulls ref from its registry
+func (c *dockerClient) PullImage(ctx context.Context, ref string) error {
+	query := url.Values{"fromImage": {ref}}
+	resp, err := c.request(ctx, http.MethodPost, "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return readProgress(resp.Body)
+}
+
+// RemoveImage removes a local image
+func (c *dockerClient) RemoveImage(ctx context.Context, ref string) error {
+	return c.call(ctx, http.MethodDelete, "/images/"+ref, nil, nil, nil)
+}
+
+// readProgress drains a build or pull progress stream and returns the first reported error
+func readProgress(stream io.Reader) error {
+	var lastLines []string
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var message struct {
+			Stream string `json:"stream"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			continue
+		}
+		if message.Error != "" {
+			return fmt.Errorf("%s\n%s", message.Error, strings.Join(lastLines, "\n"))
+		}
+		if line := strings.TrimSpace(message.Stream + message.Status); line != "" {
+			lastLines = append(lastLines, line)
+			if len(lastLines) > 10 {
+				lastLines = lastLines[1:]
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// tarDirectory streams dir as a build context without what .dockerignore
+// excludes. The archive is written while it is read, so large contexts are
+// never held in memory; closing the reader stops the writer.
+func tarDirectory(dir string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := walkBuildContext(dir, func(path, rel string, info os.FileInfo) error {
+			link := ""
+			if info.Mode()&os.ModeSymlink != 0 {
+				var err error
+				if link, err = os.Readlink(path); err != nil {
+					return err
+				}
+			} else if !info.Mode().IsRegular() && !info.IsDir() {
+				return nil
+			}
+
+			header, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			header.Name = rel
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(tw, file)
+			return err
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to read build context %s: %w", dir, err)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDockerClient(t *testing.T, handler http.HandlerFunc) *dockerClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := newDockerClient("tcp://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("newDockerClient unexpected error: %v", err)
+	}
+	return client
+}
+
+func TestDockerListContainers(t *testing.T) {
+	client := newTestDockerClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+dockerAPIVersion+"/containers/json" {
+			t.Errorf("unexpected request path %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("all") != "1" || !strings.Contains(r.URL.Query().Get("filters"), `"name":["lab-"]`) {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`[{
+			"Id": "abc", "Names": ["/lab-01"], "Image": "lab/image:latest",
+			"State": "running", "Status": "Up 2 minutes",
+			"Ports": [
+				{"IP": "::", "PrivatePort": 22, "PublicPort": 2222, "Type": "tcp"},
+				{"IP": "0.0.0.0", "PrivatePort": 22, "PublicPort": 2222, "Type": "tcp"}
+			]
+		}]`))
+	})
+
+	containers, err := client.ListContainers(context.Background(), ListOptions{All: true, Name: "lab-"})
+	if err != nil {
+		t.Fatalf("ListContainers unexpected error: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("ListContainers returned %d containers, expected 1", len(containers))
+	}
+	container := containers[0]
+	if container.Name != "lab-01" || !container.Running() || container.SSHPort() != 2222 {
+		t.Errorf("container = %+v, expected running lab-01 with SSH on 2222", container)
+	}
+}
+
+func TestDockerAPIErrors(t *testing.T) {
+	client := newTestDockerClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "No such image: lab/image:latest"})
+	})
+
+	exists, err := client.ImageExists(context.Background(), "lab/image:latest")
+	if err != nil || exists {
+		t.Errorf("ImageExists = %v, %v, expected false without error", exists, err)
+	}
+
+	err = client.RemoveNetwork(context.Background(), "lab-network")
+	if !isNotFound(err) || !strings.Contains(err.Error(), "No such image") {
+		t.Errorf("RemoveNetwork error = %v, expected a not found API error with the engine message", err)
+	}
+}
+
+func TestNewDockerClientRejectsUnsupportedHosts(t *testing.T) {
+	if _, err := newDockerClient("ssh://user@host"); err == nil {
+		t.Errorf("newDockerClient(ssh://) expected error, got nil")
+	}
+}
+
+func TestDockerExec(t *testing.T) {
+	client := newTestDockerClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + dockerAPIVersion + "/containers/lab-01/exec":
+			w.Write([]byte(`{"Id": "exec1"}`))
+		case "/" + dockerAPIVersion + "/exec/exec1/start":
+			// One stdout frame followed by one stderr frame
+			w.Write(append([]byte{1, 0, 0, 0, 0, 0, 0, 3}, "ok\n"...))
+			w.Write(append([]byte{2, 0, 0, 0, 0, 0, 0, 4}, "err\n"...))
+		case "/" + dockerAPIVersion + "/exec/exec1/json":
+			w.Write([]byte(`{"ExitCode": 3}`))
+		default:
+			t.Errorf("unexpected request path %s", r.URL.Path)
+		}
+	})
+
+	var stdout, stderr strings.Builder
+	code, err := client.Exec(context.Background(), "lab-01", []string{"true"}, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("Exec unexpected error: %v", err)
+	}
+	if code != 3 || stdout.String() != "ok\n" || stderr.String() != "err\n" {
+		t.Errorf("Exec = %d, %q, %q, expected 3, \"ok\\n\", \"err\\n\"", code, stdout.String(), stderr.String())
+	}
+}
+
+func TestDockerContainerLogs(t *testing.T) {
+	since := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	client := newTestDockerClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+dockerAPIVersion+"/containers/lab-01/logs" {
+			t.Errorf("unexpected request path %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("timestamps") != "1" || query.Get("follow") != "1" || query.Get("since") != "1792144800" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		w.Write(append([]byte{1, 0, 0, 0, 0, 0, 0, 9}, "line one\n"...))
+		w.Write(append([]byte{2, 0, 0, 0, 0, 0, 0, 9}, "line two\n"...))
+	})
+
+	var output strings.Builder
+	err := client.ContainerLogs(context.Background(), "lab-01", LogOptions{Follow: true, Since: since}, &output, &output)
+	if err != nil || output.String() != "line one\nline two\n" {
+		t.Errorf("ContainerLogs = %q, %v; expected both lines", output.String(), err)
+	}
+}
+
+func TestNewRuntimeRejectsUnknownNames(t *testing.T) {
+	if _, err := newRuntime("lxc"); err == nil || !strings.Contains(err.Error(), "docker, podman, nerdctl") {
+		t.Errorf("newRuntime(lxc) error = %v, expected the list of supported runtimes", err)
+	}
+}
+
+func TestDockerBuildImageLabels(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644)
+	client := newTestDockerClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + dockerAPIVersion + "/build":
+			io.Copy(io.Discard, r.Body)
+			var labels map[string]string
+			if err := json.Unmarshal([]byte(r.URL.Query().Get("labels")), &labels); err != nil || labels[labBuildHashLabel] != "abc" {
+				t.Errorf("build labels = %q, expected the build hash", r.URL.Query().Get("labels"))
+			}
+			w.Write([]byte(`{"stream": "Successfully built"}`))
+		case "/" + dockerAPIVersion + "/images/lab/image:latest/json":
+			w.Write([]byte(`{"Id": "sha256:1", "Config": {"Labels": {"lab.build-hash": "abc"}}}`))
+		default:
+			t.Errorf("unexpected request path %s", r.URL.Path)
+		}
+	})
+
+	if err := client.BuildImage(context.Background(), dir, "lab/image:latest", imageLabels("abc")); err != nil {
+		t.Fatalf("BuildImage unexpected error: %v", err)
+	}
+	labels, err := client.ImageLabels(context.Background(), "lab/image:latest")
+	if err != nil || labels[labBuildHashLabel] != "abc" {
+		t.Errorf("ImageLabels = %v, %v, expected the build hash", labels, err)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ways exec reaches the nodes
+const (
+	viaSSH       = "ssh"
+	viaContainer = "container"
+)
+
+// nodeColors colour node prefixes, cycling in node order
+var nodeColors = []func(a ...interface{}) string{cyan, green, yellow, blue, magenta}
+
+// execOptions controls how exec runs a command across nodes
+type execOptions struct {
+	Nodes    string // comma-separated node names or glob patterns, empty for all
+	Group    string // spec group whose nodes are selected
+	Via      string // ssh or container
+	User     string // SSH user, empty for the lab user
+	Parallel int
+	Grouped  bool // collate identical output like dshbak instead of prefixing lines
+}
+
+// execResult is the outcome of the command on one node
+type execResult struct {
+	Node     string
+	Code     int
+	Err      error // the command could not be run
+	Duration time.Duration
+	Output   *lockedBuffer // combined output, kept for grouped display
+}
+
+// errOut returns the writer for messages that must not mix with command output
+func (a *App) errOut() io.Writer {
+	if a.Err != nil {
+		return a.Err
+	}
+	return a.Out
+}
+
+// selectNodes returns the running containers chosen by a comma-separated list
+// of node names or glob patterns and a spec group; both empty selects every node
+func (a *App) selectNodes(ctx context.Context, spec *LabSpec, nodes, group string) ([]Container, error) {
+	containers, err := a.getContainers(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, errNoContainers
+	}
+	return filterNodes(spec, containers, nodes, group)
+}
+
+// filterNodes returns the containers selected by node patterns and a spec
+// group, including the members of its child groups
+func filterNodes(spec *LabSpec, containers []Container, nodes, group string) ([]Container, error) {
+	var members map[string]bool
+	if group != "" {
+		if _, ok := spec.Groups[group]; !ok {
+			return nil, fmt.Errorf("unknown group %q (groups: %s)", group, strings.Join(spec.groupNames(), ", "))
+		}
+		members = map[string]bool{}
+		for _, member := range spec.groupMembers(group) {
+			members[member] = true
+		}
+	}
+
+	var patterns []string
+	for _, pattern := range strings.Split(nodes, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("--nodes: bad pattern %q", pattern)
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	var selected []Container
+	for _, container := range containers {
+		name := spec.nodeName(container)
+		if members != nil && !members[name] {
+			continue
+		}
+		if len(patterns) > 0 && !matchAny(patterns, name) {
+			continue
+		}
+		selected = append(selected, container)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no running node of lab %s matches the selection", spec.Name)
+	}
+	return selected, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// execNodes runs command on the selected nodes concurrently. Output is
+// streamed with a coloured node prefix, or collated by identical output when
+// opts.Grouped is set. It fails when the command fails on any node.
+func (a *App) execNodes(ctx context.Context, spec *LabSpec, command []string, opts execOptions) error {
+	if len(command) == 0 {
+		return errors.New("no command given - usage: ./lab exec [--nodes SEL] [--group G] -- <command>")
+	}
+	switch opts.Via {
+	case "", viaSSH:
+		opts.Via = viaSSH
+	case viaContainer:
+		if opts.User != "" {
+			return errors.New("--user only applies to --via ssh; container exec runs as root")
+		}
+	default:
+		return fmt.Errorf("--via must be %s or %s", viaSSH, viaContainer)
+	}
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+
+	containers, err := a.selectNodes(ctx, spec, opts.Nodes, opts.Group)
+	if err != nil {
+		return err
+	}
+
+	width := 0
+	for _, container := range containers {
+		width = max(width, len(spec.nodeName(container)))
+	}
+
+	var outMu sync.Mutex
+	results := make([]execResult, len(containers))
+	sem := make(chan struct{}, opts.Parallel)
+	var wg sync.WaitGroup
+	for i, container := range containers {
+		node := spec.nodeName(container)
+		result := &results[i]
+		result.Node = node
+
+		var stdout, stderr io.Writer
+		var prefixed *prefixWriter
+		if opts.Grouped {
+			result.Output = &lockedBuffer{}
+			stdout, stderr = result.Output, result.Output
+		} else {
+			color := nodeColors[i%len(nodeColors)]
+			prefixed = &prefixWriter{mu: &outMu, out: a.Out, prefix: color(fmt.Sprintf("%-*s |", width, node)) + " "}
+			stdout, stderr = prefixed, prefixed
+		}
+
+		wg.Add(1)
+		go func(container Container) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			result.Code, result.Err = a.execNode(ctx, spec, container, command, opts, stdout, stderr)
+			result.Duration = time.Since(start)
+			if prefixed != nil {
+				prefixed.Flush()
+			}
+		}(container)
+	}
+	wg.Wait()
+
+	if opts.Grouped {
+		printGroupedOutput(a.Out, results)
+	}
+	return a.printExecSummary(results)
+}
+
+// execNode runs command on one node and returns its exit status
+func (a *App) execNode(ctx context.Context, spec *LabSpec, container Container, command []string, opts execOptions, stdout, stderr io.Writer) (int, error) {
+	if opts.Via == viaContainer {
+		return a.Runtime.Exec(ctx, container.ID, []string{"sh", "-c", strings.Join(command, " ")}, stdout, stderr)
+	}
+
+	runner, ok := a.SSH.(shellRunner)
+	if !ok {
+		return 0, errors.New("the SSH client does not support streaming commands")
+	}
+	target, err := a.nodeTarget(ctx, spec, spec.nodeName(container), opts.User)
+	if err != nil {
+		return 0, err
+	}
+	return runner.Shell(ctx, target, ShellOptions{Command: strings.Join(command, " "), Stdout: stdout, Stderr: stderr})
+}
+
+// printGroupedOutput prints each distinct output once under the nodes that produced it
+func printGroupedOutput(w io.Writer, results []execResult) {
+	var outputs []string
+	nodes := map[string][]string{}
+	for _, result := range results {
+		output := result.Output.String()
+		if _, seen := nodes[output]; !seen {
+			outputs = append(outputs, output)
+		}
+		nodes[output] = append(nodes[output], result.Node)
+	}
+	sort.SliceStable(outputs, func(i, j int) bool { return len(nodes[outputs[i]]) > len(nodes[outputs[j]]) })
+
+	for _, output := range outputs {
+		fmt.Fprintf(w, "%s\n", blue("───────────────────────────────────"))
+		fmt.Fprintf(w, "%s\n", bold(strings.Join(nodes[output], ", ")))
+		fmt.Fprintf(w, "%s\n", blue("───────────────────────────────────"))
+		if output == "" {
+			fmt.Fprintf(w, "%s\n", yellow("(no output)"))
+			continue
+		}
+		fmt.Fprint(w, output)
+		if !strings.HasSuffix(output, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// printExecSummary lists the exit status of every node and fails when any node failed
+func (a *App) printExecSummary(results []execResult) error {
+	w := a.errOut()
+	fmt.Fprintf(w, "\n%s\n", bold("Exit Codes:"))
+	var failures []string
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failures = append(failures, fmt.Sprintf("%s (%s)", result.Node, sshReason(result.Err)))
+			fmt.Fprintf(w, "  %s %s %s %s\n", red("✗"), bold(result.Node), red(sshReason(result.Err)), formatLatency(result.Duration))
+		case result.Code != 0:
+			failures = append(failures, fmt.Sprintf("%s (exit %d)", result.Node, result.Code))
+			fmt.Fprintf(w, "  %s %s %s %s\n", red("✗"), bold(result.Node), red(fmt.Sprintf("exit %d", result.Code)), formatLatency(result.Duration))
+		default:
+			fmt.Fprintf(w, "  %s %s %s %s\n", green("✓"), bold(result.Node), green("exit 0"), formatLatency(result.Duration))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("command failed on %d of %d nodes: %s", len(failures), len(results), strings.Join(failures, ", "))
+	}
+	fmt.Fprintf(w, "%s Command succeeded on all %d nodes\n", green("✅"), len(results))
+	return nil
+}
+
+// prefixWriter writes complete lines to out with a prefix, so lines from
+// concurrent nodes never interleave
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+
+	lineMu sync.Mutex
+	line   []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.lineMu.Lock()
+	defer w.lineMu.Unlock()
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.writeLine(w.line[:i])
+		w.line = w.line[i+1:]
+	}
+}
+
+// Flush writes a final line that did not end with a newline
+func (w *prefixWriter) Flush() {
+	w.lineMu.Lock()
+	defer w.lineMu.Unlock()
+	if len(w.line) > 0 {
+		w.writeLine(w.line)
+		w.line = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintf(w.out, "%s%s\n", w.prefix, bytes.TrimRight(line, "\r"))
+}
+
+// lockedBuffer is a bytes.Buffer that stdout and stderr can write to concurrently
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExecNodesPrefixesOutput(t *testing.T) {
+	app, rt, dialer, out := newTestApp()
+	for i, name := range []string{"lab-01", "lab-02", "lab-03"} {
+		rt.addContainer(defaultLabName, name, "running", 2222+i)
+	}
+	dialer.exitCodes = map[int]int{2223: 3}
+	dialer.failures = map[int]error{2224: &SSHError{Reason: reasonRefused, Err: errors.New("dial tcp")}}
+
+	err := app.execNodes(context.Background(), defaultSpec(defaultLabName, 3), []string{"echo", "hello"}, execOptions{Parallel: 2})
+	if err == nil || err.Error() != "command failed on 2 of 3 nodes: lab-02 (exit 3), lab-03 (connection refused)" {
+		t.Errorf("execNodes error = %v, expected lab-02 and lab-03 to fail", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{"lab-01 | hello", "lab-02 | hello", "lab-01 exit 0", "lab-02 exit 3", "lab-03 connection refused"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestExecNodesGroupsIdenticalOutput(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	for i, name := range []string{"lab-01", "lab-02", "lab-03"} {
+		rt.addContainer(defaultLabName, name, "running", 2222+i)
+	}
+	rt.exec = func(name string, cmd []string, stdout, stderr io.Writer) (int, error) {
+		if name == "lab-03" {
+			io.WriteString(stdout, "inactive\n")
+			return 3, nil
+		}
+		io.WriteString(stdout, "active\n")
+		return 0, nil
+	}
+
+	err := app.execNodes(context.Background(), defaultSpec(defaultLabName, 3), []string{"systemctl", "is-active", "nginx"},
+		execOptions{Via: viaContainer, Grouped: true, Parallel: 3})
+	if err == nil || !strings.Contains(err.Error(), "lab-03 (exit 3)") {
+		t.Errorf("execNodes error = %v, expected lab-03 to fail", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "lab-01, lab-02\n") || !strings.Contains(output, "lab-03\n") || strings.Count(output, "active\n") != 2 {
+		t.Errorf("output should show each distinct output once:\n%s", output)
+	}
+	if strings.Index(output, "lab-01, lab-02") > strings.Index(output, "inactive") {
+		t.Errorf("the largest group should come first:\n%s", output)
+	}
+}
+
+func TestSelectNodes(t *testing.T) {
+	app, rt, _, _ := newTestApp()
+	for i, name := range []string{"lab-01", "lab-02", "lab-03"} {
+		rt.addContainer(defaultLabName, name, "running", 2222+i)
+	}
+	spec := defaultSpec(defaultLabName, 3)
+	spec.Groups = map[string]GroupSpec{"web": {Hosts: []string{"lab-02", "lab-03"}}}
+
+	tests := []struct {
+		nodes, group string
+		expected     string
+	}{
+		{"", "", "lab-01 lab-02 lab-03"},
+		{"lab-01,lab-03", "", "lab-01 lab-03"},
+		{"lab-0[12]", "", "lab-01 lab-02"},
+		{"", "web", "lab-02 lab-03"},
+		{"lab-0[12]", "web", "lab-02"},
+	}
+	for _, test := range tests {
+		containers, err := app.selectNodes(context.Background(), spec, test.nodes, test.group)
+		var names []string
+		for _, container := range containers {
+			names = append(names, spec.nodeName(container))
+		}
+		if err != nil || strings.Join(names, " ") != test.expected {
+			t.Errorf("selectNodes(%q, %q) = %v, %v, expected %s", test.nodes, test.group, names, err, test.expected)
+		}
+	}
+
+	if _, err := app.selectNodes(context.Background(), spec, "", "db"); err == nil || !strings.Contains(err.Error(), `unknown group "db" (groups: web)`) {
+		t.Errorf("selectNodes with an unknown group error = %v", err)
+	}
+	if _, err := app.selectNodes(context.Background(), spec, "web-*", ""); err == nil {
+		t.Errorf("selectNodes matching nothing expected an error")
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// exporter describes an inventory format for a tool other than Ansible. Every
+// exporter renders the same inventory, so nodes, ports and credentials match.
+type exporter struct {
+	Tool  string
+	Usage string // how the tool uses the exported file; %[1]s is its path
+}
+
+// exporters are the inventory --format values beyond Ansible's own
+var exporters = map[string]exporter{
+	"salt":    {"Salt SSH", "salt-ssh --roster-file %[1]s '*' test.ping"},
+	"pyinfra": {"pyinfra", "pyinfra %[1]s exec -- uptime"},
+	"nornir":  {"Nornir", "InitNornir(inventory={\"plugin\": \"SimpleInventory\", \"options\": {\"host_file\": \"%[1]s/hosts.yaml\", \"group_file\": \"%[1]s/groups.yaml\"}})"},
+	"bolt":    {"Puppet Bolt", "bolt command run uptime --targets lab_nodes --inventoryfile %[1]s"},
+	"knife":   {"knife ssh", "knife ssh --manual-list \"$(grep -v '^#' %[1]s)\" uptime"},
+}
+
+// sshConnection is how a node is reached, taken from its Ansible connection vars
+type sshConnection struct {
+	Host     string
+	Port     int
+	User     string
+	KeyFile  string
+	Password string
+}
+
+// connection returns the SSH connection of a host of the inventory
+func (inv *labInventory) connection(host string) sshConnection {
+	vars := inv.HostVars[host]
+	conn := sshConnection{}
+	conn.Host, _ = vars["ansible_host"].(string)
+	conn.Port, _ = vars["ansible_port"].(int)
+	conn.User, _ = vars["ansible_user"].(string)
+	conn.KeyFile, _ = vars["ansible_ssh_private_key_file"].(string)
+	if password, ok := vars["ansible_ssh_pass"].(inventorySecret); ok {
+		conn.Password = string(password)
+	}
+	return conn
+}
+
+// hostData returns the vars of a host without Ansible's own vars
+func (inv *labInventory) hostData(host string) map[string]any {
+	return withoutAnsibleVars(inv.HostVars[host])
+}
+
+// groupData returns the vars of a group without Ansible's own vars
+func (inv *labInventory) groupData(group string) map[string]any {
+	return withoutAnsibleVars(inv.Groups[group].Vars)
+}
+
+// withoutAnsibleVars drops the ansible_ vars, which other tools have their own settings for
+func withoutAnsibleVars(vars map[string]any) map[string]any {
+	data := map[string]any{}
+	for name, value := range vars {
+		if !strings.HasPrefix(name, "ansible_") {
+			data[name] = value
+		}
+	}
+	return data
+}
+
+// hosts returns every host in the order the lab lists them
+func (inv *labInventory) hosts() []string {
+	return inv.Groups["lab_nodes"].Hosts
+}
+
+// hostGroups returns the groups that list host directly, in group order
+func (inv *labInventory) hostGroups(host string) []string {
+	var groups []string
+	for _, name := range inv.groupOrder() {
+		for _, member := range inv.Groups[name].Hosts {
+			if member == host {
+				groups = append(groups, name)
+				break
+			}
+		}
+	}
+	return groups
+}
+
+// members returns the hosts of a group and its child groups without duplicates
+func (inv *labInventory) members(group string) []string {
+	seen := map[string]bool{}
+	var members []string
+	var collect func(name string)
+	collect = func(name string) {
+		for _, host := range inv.Groups[name].Hosts {
+			if !seen[host] {
+				seen[host] = true
+				members = append(members, host)
+			}
+		}
+		for _, child := range inv.Groups[name].Children {
+			collect(child)
+		}
+	}
+	collect(group)
+	return members
+}
+
+// sudo reports whether the lab user may use sudo
+func (inv *labInventory) sudo() bool {
+	sudo, _ := inv.Groups["lab_nodes"].Vars["lab_sudo_enabled"].(bool)
+	return sudo
+}
+
+// encodeExport writes value as YAML headed by a comment naming the format
+func encodeExport(title string, value any) ([]byte, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return encodeYAML(node, "LAB "+title+" (Generated)")
+}
+
+// saltTarget is an entry of a Salt SSH roster
+type saltTarget struct {
+	Host       string   `yaml:"host"`
+	Port       int      `yaml:"port"`
+	User       string   `yaml:"user"`
+	Priv       string   `yaml:"priv,omitempty"`
+	Passwd     string   `yaml:"passwd,omitempty"`
+	Sudo       bool     `yaml:"sudo,omitempty"`
+	SSHOptions []string `yaml:"ssh_options"`
+}
+
+// renderSaltRoster returns a Salt SSH roster with a target per node
+func (inv *labInventory) renderSaltRoster() ([]byte, error) {
+	roster := map[string]saltTarget{}
+	for _, host := range inv.hosts() {
+		conn := inv.connection(host)
+		roster[host] = saltTarget{
+			Host:       conn.Host,
+			Port:       conn.Port,
+			User:       conn.User,
+			Priv:       conn.KeyFile,
+			Passwd:     conn.Password,
+			Sudo:       inv.sudo(),
+			SSHOptions: []string{"StrictHostKeyChecking=no", "UserKnownHostsFile=/dev/null"},
+		}
+	}
+	return encodeExport("Salt SSH roster", roster)
+}
+
+// renderPyinfra returns a pyinfra inventory.py with a list per group. Host
+// data is given where a host is first listed and group vars become the group
+// data of a (hosts, data) tuple. pyinfra has no nested groups, so a group
+// lists the hosts of its child groups too and they get its data.
+func (inv *labInventory) renderPyinfra() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# LAB pyinfra inventory (Generated)\n")
+
+	written := map[string]bool{}
+	for _, group := range append([]string{"lab_nodes"}, inv.groupOrder()...) {
+		if written[group] {
+			continue
+		}
+		written[group] = true
+		if pythonKeywords[group] {
+			return nil, fmt.Errorf("group %q is a Python keyword and cannot be a pyinfra group - rename it", group)
+		}
+		data := inv.groupData(group)
+		if len(data) > 0 {
+			fmt.Fprintf(&buf, "\n%s = ([\n", group)
+		} else {
+			fmt.Fprintf(&buf, "\n%s = [\n", group)
+		}
+		for _, host := range inv.members(group) {
+			if group != "lab_nodes" {
+				fmt.Fprintf(&buf, "    %s,\n", pyValue(host))
+				continue
+			}
+			conn := inv.connection(host)
+			hostData := inv.hostData(host)
+			hostData["ssh_hostname"] = conn.Host
+			hostData["ssh_port"] = conn.Port
+			hostData["ssh_user"] = conn.User
+			hostData["ssh_known_hosts_file"] = "/dev/null"
+			hostData["ssh_strict_host_key_checking"] = "no"
+			if conn.KeyFile != "" {
+				hostData["ssh_key"] = conn.KeyFile
+			} else {
+				hostData["ssh_password"] = conn.Password
+			}
+			if inv.sudo() {
+				hostData["_sudo"] = true
+			}
+			fmt.Fprintf(&buf, "    (%s, %s),\n", pyValue(host), pyValue(hostData))
+		}
+		if len(data) > 0 {
+			fmt.Fprintf(&buf, "], %s)\n", pyValue(data))
+		} else {
+			buf.WriteString("]\n")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// pythonKeywords cannot be used as the variable of a pyinfra group
+var pythonKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true,
+	"async": true, "await": true, "break": true, "class": true, "continue": true,
+	"def": true, "del": true, "elif": true, "else": true, "except": true,
+	"finally": true, "for": true, "from": true, "global": true, "if": true,
+	"import": true, "in": true, "is": true, "lambda": true, "nonlocal": true,
+	"not": true, "or": true, "pass": true, "raise": true, "return": true,
+	"try": true, "while": true, "with": true, "yield": true,
+}
+
+// pyValue formats a var as a Python literal
+func pyValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = pyValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]any:
+		items := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			items = append(items, pyValue(key)+": "+pyValue(v[key]))
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	// JSON string escapes are valid in Python string literals
+	data, _ := json.Marshal(fmt.Sprint(value))
+	return string(data)
+}
+
+// nornirHost is an entry of a Nornir SimpleInventory hosts file
+type nornirHost struct {
+	Hostname          string                    `yaml:"hostname"`
+	Port              int                       `yaml:"port"`
+	Username          string                    `yaml:"username"`
+	Password          string                    `yaml:"password,omitempty"`
+	Platform          string                    `yaml:"platform"`
+	Groups            []string                  `yaml:"groups,omitempty"`
+	Data              map[string]any            `yaml:"data,omitempty"`
+	ConnectionOptions map[string]nornirConnOpts `yaml:"connection_options,omitempty"`
+}
+
+// nornirConnOpts passes the lab key to a Nornir connection plugin
+type nornirConnOpts struct {
+	Extras map[string]any `yaml:"extras"`
+}
+
+// nornirGroup is an entry of a Nornir SimpleInventory groups file
+type nornirGroup struct {
+	Groups []string       `yaml:"groups,omitempty"`
+	Data   map[string]any `yaml:"data,omitempty"`
+}
+
+// writeNornir writes hosts.yaml and groups.yaml for Nornir's SimpleInventory.
+// Nornir groups name their parents, so the children of the inventory are inverted.
+func (inv *labInventory) writeNornir(dir string) error {
+	hosts := map[string]nornirHost{}
+	for _, host := range inv.hosts() {
+		conn := inv.connection(host)
+		entry := nornirHost{
+			Hostname: conn.Host,
+			Port:     conn.Port,
+			Username: conn.User,
+			Password: conn.Password,
+			Platform: "linux",
+			Groups:   inv.hostGroups(host),
+			Data:     inv.hostData(host),
+		}
+		if conn.KeyFile != "" {
+			entry.ConnectionOptions = map[string]nornirConnOpts{
+				"paramiko": {Extras: map[string]any{"key_filename": conn.KeyFile}},
+				"netmiko":  {Extras: map[string]any{"use_keys": true, "key_file": conn.KeyFile}},
+			}
+		}
+		hosts[host] = entry
+	}
+
+	groups := map[string]nornirGroup{}
+	for _, name := range inv.groupOrder() {
+		group := groups[name]
+		group.Data = inv.groupData(name)
+		groups[name] = group
+		for _, child := range inv.Groups[name].Children {
+			parent := groups[child]
+			parent.Groups = append(parent.Groups, name)
+			groups[child] = parent
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create inventory directory: %w", err)
+	}
+	for file, value := range map[string]any{"hosts.yaml": hosts, "groups.yaml": groups} {
+		content, err := encodeExport("Nornir "+strings.TrimSuffix(file, ".yaml"), value)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), content, 0600); err != nil {
+			return fmt.Errorf("failed to write inventory file: %w", err)
+		}
+	}
+	return nil
+}
+
+// boltGroupPattern is what Bolt accepts as a group name
+var boltGroupPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// boltGroup is a group of a Bolt inventory; child groups are nested in it
+type boltGroup struct {
+	Name    string         `yaml:"name"`
+	Targets []any          `yaml:"targets,omitempty"`
+	Groups  []boltGroup    `yaml:"groups,omitempty"`
+	Vars    map[string]any `yaml:"vars,omitempty"`
+}
+
+// boltTarget defines a target with its URI where it is first listed
+type boltTarget struct {
+	Name   string         `yaml:"name"`
+	URI    string         `yaml:"uri"`
+	Config map[string]any `yaml:"config,omitempty"`
+	Vars   map[string]any `yaml:"vars,omitempty"`
+}
+
+// renderBolt returns a Puppet Bolt inventory.yaml with the groups nested as
+// in the Ansible inventory. Each group is defined where it is first reached.
+func (inv *labInventory) renderBolt() ([]byte, error) {
+	for _, name := range inv.groupOrder() {
+		if !boltGroupPattern.MatchString(name) {
+			return nil, fmt.Errorf("group %q is not a valid Bolt group name - Bolt only allows lowercase letters, digits and underscores", name)
+		}
+	}
+
+	seenGroups, seenHosts := map[string]bool{}, map[string]bool{}
+	var group func(name string) boltGroup
+	group = func(name string) boltGroup {
+		seenGroups[name] = true
+		g := boltGroup{Name: name, Vars: inv.groupData(name)}
+		for _, host := range inv.Groups[name].Hosts {
+			if seenHosts[host] {
+				g.Targets = append(g.Targets, host)
+				continue
+			}
+			seenHosts[host] = true
+			conn := inv.connection(host)
+			target := boltTarget{Name: host, URI: fmt.Sprintf("%s:%d", conn.Host, conn.Port), Vars: inv.hostData(host)}
+			if conn.KeyFile != "" {
+				target.Config = map[string]any{"ssh": map[string]any{"private-key": conn.KeyFile}}
+			} else {
+				target.Config = map[string]any{"ssh": map[string]any{"password": conn.Password}}
+			}
+			g.Targets = append(g.Targets, target)
+		}
+		for _, child := range inv.Groups[name].Children {
+			if !seenGroups[child] {
+				g.Groups = append(g.Groups, group(child))
+			}
+		}
+		return g
+	}
+
+	var groups []boltGroup
+	for _, name := range inv.Groups["all"].Children {
+		groups = append(groups, group(name))
+	}
+
+	ssh := map[string]any{"host-key-check": false}
+	if hosts := inv.hosts(); len(hosts) > 0 {
+		ssh["user"] = inv.connection(hosts[0]).User
+	}
+	return encodeExport("Puppet Bolt inventory", map[string]any{
+		"groups": groups,
+		"config": map[string]any{"transport": "ssh", "ssh": ssh},
+	})
+}
+
+// renderKnife returns the nodes as user@host:port lines, the host list format
+// of knife ssh --manual-list and pssh -h
+func (inv *labInventory) renderKnife() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# LAB node list (Generated)\n")
+	hosts := inv.hosts()
+	if len(hosts) > 0 {
+		if conn := inv.connection(hosts[0]); conn.KeyFile != "" {
+			fmt.Fprintf(&buf, "# Log in with the lab key: knife ssh -i %s, pssh -x '-i %s'\n", conn.KeyFile, conn.KeyFile)
+		}
+	}
+	lines := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		conn := inv.connection(host)
+		lines = append(lines, fmt.Sprintf("%s@%s:%d", conn.User, conn.Host, conn.Port))
+	}
+	buf.WriteString(strings.Join(lines, "\n"))
+	if len(lines) > 0 {
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
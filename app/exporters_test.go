@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportersShareConnection(t *testing.T) {
+	spec, inventory := testInventory()
+
+	for _, format := range []string{"salt", "pyinfra", "bolt", "knife"} {
+		content, err := inventory.render(format, nil)
+		if err != nil {
+			t.Fatalf("render %s unexpected error: %v", format, err)
+		}
+		for _, expected := range []string{"2222", defaultUser, "localhost"} {
+			if !strings.Contains(string(content), expected) {
+				t.Errorf("%s export missing %q:\n%s", format, expected, content)
+			}
+		}
+		if strings.Contains(string(content), "lab-02") || strings.Contains(string(content), "ansible_") {
+			t.Errorf("%s export should only have the running node and no Ansible vars:\n%s", format, content)
+		}
+	}
+
+	content, _ := inventory.render("salt", nil)
+	var roster map[string]saltTarget
+	if err := yaml.Unmarshal(content, &roster); err != nil {
+		t.Fatalf("salt roster does not parse: %v\n%s", err, content)
+	}
+	if target := roster["lab-01"]; target.Port != 2222 || target.Passwd != spec.User.Password || !target.Sudo {
+		t.Errorf("roster lab-01 = %+v, expected port 2222 and the lab password", target)
+	}
+
+	content, _ = inventory.render("bolt", nil)
+	var bolt struct {
+		Groups []boltGroup `yaml:"groups"`
+	}
+	if err := yaml.Unmarshal(content, &bolt); err != nil {
+		t.Fatalf("bolt inventory does not parse: %v\n%s", err, content)
+	}
+	if len(bolt.Groups) != 1 || bolt.Groups[0].Name != "lab_environment" || len(bolt.Groups[0].Groups) != 2 {
+		t.Fatalf("bolt groups = %+v, expected lab_nodes and frontend below lab_environment", bolt.Groups)
+	}
+	if web := bolt.Groups[0].Groups[1].Groups; len(web) != 1 || web[0].Name != "web" || web[0].Vars["http_port"] != 8080 {
+		t.Errorf("frontend groups = %+v, expected web with its vars", web)
+	}
+
+	content, _ = inventory.render("knife", nil)
+	if !strings.HasSuffix(string(content), "\n"+defaultUser+"@localhost:2222\n") {
+		t.Errorf("knife node list = %q, expected a user@host:port line", content)
+	}
+
+	content, _ = inventory.render("pyinfra", nil)
+	for _, expected := range []string{"\nweb = ([\n    \"lab-01\",\n], {\"http_port\": 8080})\n", "\"lab_user_password\": \"" + spec.User.Password} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("pyinfra inventory missing the group data %q:\n%s", expected, content)
+		}
+	}
+
+	spec.keyFile = "/home/me/.lab/lab/id_ed25519"
+	content, _ = buildInventory(spec, []Container{{Name: "lab-01", State: "running", Labels: map[string]string{labNodeLabel: "lab-01"},
+		Ports: []PortBinding{{HostPort: 2222, ContainerPort: 22, Protocol: "tcp"}}}}).render("pyinfra", nil)
+	if !strings.Contains(string(content), `"ssh_key": "/home/me/.lab/lab/id_ed25519"`) || strings.Contains(string(content), "ssh_password") {
+		t.Errorf("pyinfra inventory should log in with the lab key:\n%s", content)
+	}
+}
+
+func TestExportersRejectBadGroupNames(t *testing.T) {
+	for format, group := range map[string]string{"bolt": "WebServers", "pyinfra": "class"} {
+		spec := defaultSpec(defaultLabName, 1)
+		spec.Groups = map[string]GroupSpec{group: {Hosts: []string{"lab-01"}}}
+		inventory := buildInventory(spec, []Container{{Name: "lab-01", State: "running", Labels: map[string]string{labNodeLabel: "lab-01"},
+			Ports: []PortBinding{{HostPort: 2222, ContainerPort: 22, Protocol: "tcp"}}}})
+
+		if _, err := inventory.render(format, nil); err == nil || !strings.Contains(err.Error(), `"`+group+`"`) {
+			t.Errorf("render %s error = %v, expected it to name the group %s", format, err, group)
+		}
+	}
+}
+
+func TestWriteNornir(t *testing.T) {
+	_, inventory := testInventory()
+	dir := filepath.Join(t.TempDir(), "nornir")
+	if err := inventory.writeNornir(dir); err != nil {
+		t.Fatalf("writeNornir unexpected error: %v", err)
+	}
+
+	var hosts map[string]nornirHost
+	data, _ := os.ReadFile(filepath.Join(dir, "hosts.yaml"))
+	if err := yaml.Unmarshal(data, &hosts); err != nil {
+		t.Fatalf("hosts.yaml does not parse: %v\n%s", err, data)
+	}
+	if host := hosts["lab-01"]; host.Port != 2222 || !slices.Equal(host.Groups, []string{"lab_nodes", "web"}) || host.Data["role"] != "primary" {
+		t.Errorf("hosts lab-01 = %+v, expected port 2222, its groups and vars", host)
+	}
+
+	var groups map[string]nornirGroup
+	data, _ = os.ReadFile(filepath.Join(dir, "groups.yaml"))
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		t.Fatalf("groups.yaml does not parse: %v\n%s", err, data)
+	}
+	// Nornir groups name their parents, the reverse of Ansible's children
+	if !slices.Equal(groups["web"].Groups, []string{"frontend"}) || !slices.Equal(groups["frontend"].Groups, []string{"lab_environment"}) {
+		t.Errorf("groups = %+v, expected web in frontend in lab_environment", groups)
+	}
+}
+
+func TestExportRejectsVault(t *testing.T) {
+	app, rt, _, _ := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	path := filepath.Join(t.TempDir(), "roster")
+
+	err := app.generateInventory(context.Background(), defaultSpec(defaultLabName, 1), inventoryOptions{Format: "salt", Path: path, VaultPasswordFile: "vault-pass"})
+	if err == nil || !strings.Contains(err.Error(), "--vault-password-file") {
+		t.Errorf("generateInventory error = %v, expected --vault-password-file to be rejected", err)
+	}
+}
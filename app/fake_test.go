@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeRuntime is an in-memory Runtime for exercising commands without a container engine
+type fakeRuntime struct {
+	mu         sync.Mutex
+	containers map[string]*Container
+	networks   map[string]Network
+	volumes    map[string]Volume
+	images     map[string]bool
+	// imageLabels holds the labels of built images
+	imageLabels map[string]map[string]string
+	configs     map[string]ContainerConfig
+	calls       []string
+	nextID      int
+
+	// removeErrors makes removing the named resources fail
+	removeErrors map[string]error
+
+	// exec, when set, handles Exec calls
+	exec func(id string, cmd []string, stdout, stderr io.Writer) (int, error)
+
+	// logs holds the timestamped output of containers by name
+	logs map[string]string
+}
+
+var _ Runtime = (*fakeRuntime)(nil)
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		containers:  map[string]*Container{},
+		networks:    map[string]Network{},
+		volumes:     map[string]Volume{},
+		images:      map[string]bool{},
+		imageLabels: map[string]map[string]string{},
+		configs:     map[string]ContainerConfig{},
+	}
+}
+
+func (f *fakeRuntime) record(format string, args ...interface{}) {
+	f.calls = append(f.calls, fmt.Sprintf(format, args...))
+}
+
+// called reports whether a call with the given prefix was recorded
+func (f *fakeRuntime) called(prefix string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.calls {
+		if strings.HasPrefix(call, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeRuntime) find(id string) (*Container, error) {
+	for _, container := range f.containers {
+		if container.ID == id || container.Name == id {
+			return container, nil
+		}
+	}
+	return nil, &apiError{StatusCode: 404, Message: "No such container: " + id}
+}
+
+// addContainer registers a node container of lab as if it had been created
+// earlier; an empty lab adds a container the tool does not own
+func (f *fakeRuntime) addContainer(lab, name, state string, sshPort int) *Container {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	container := &Container{
+		ID:     fmt.Sprintf("id-%d", f.nextID),
+		Name:   name,
+		Image:  defaultImage,
+		State:  state,
+		Labels: map[string]string{labNameLabel: lab, labRoleLabel: roleNode, labNodeLabel: name},
+		Ports:  []PortBinding{{HostIP: "0.0.0.0", HostPort: sshPort, ContainerPort: 22, Protocol: "tcp"}},
+	}
+	if lab == "" {
+		container.Labels = map[string]string{}
+	}
+	f.containers[name] = container
+	return container
+}
+
+func (f *fakeRuntime) Name() string { return "fake" }
+
+func (f *fakeRuntime) ListContainers(ctx context.Context, opts ListOptions) ([]Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	containers := []Container{}
+	for _, container := range f.containers {
+		if !strings.Contains(container.Name, opts.Name) || (!opts.All && !container.Running()) || !matchLabels(container.Labels, opts.Labels) {
+			continue
+		}
+		containers = append(containers, *container)
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].ID < containers[j].ID })
+	return containers, nil
+}
+
+func (f *fakeRuntime) InspectContainer(ctx context.Context, id string) (Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	container, err := f.find(id)
+	if err != nil {
+		return Container{}, err
+	}
+	return *container, nil
+}
+
+func (f *fakeRuntime) CreateContainer(ctx context.Context, config ContainerConfig) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("create container %s", config.Name)
+	if _, exists := f.containers[config.Name]; exists {
+		return "", &apiError{StatusCode: 409, Message: "name already in use: " + config.Name}
+	}
+	f.nextID++
+	id := fmt.Sprintf("id-%d", f.nextID)
+	f.containers[config.Name] = &Container{
+		ID:      id,
+		Name:    config.Name,
+		Image:   config.Image,
+		State:   "created",
+		Labels:  config.Labels,
+		Ports:   config.Ports,
+		Created: time.Now(),
+	}
+	f.configs[config.Name] = config
+	return id, nil
+}
+
+func (f *fakeRuntime) StartContainer(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	container, err := f.find(id)
+	if err != nil {
+		return err
+	}
+	f.record("start container %s", container.Name)
+	container.State = "running"
+	return nil
+}
+
+func (f *fakeRuntime) StopContainer(ctx context.Context, id string, timeout time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	container, err := f.find(id)
+	if err != nil {
+		return err
+	}
+	f.record("stop container %s", container.Name)
+	container.State = "exited"
+	return nil
+}
+
+func (f *fakeRuntime) RemoveContainer(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	container, err := f.find(id)
+	if err != nil {
+		return err
+	}
+	if err := f.removeErrors[container.Name]; err != nil {
+		return err
+	}
+	f.record("remove container %s", container.Name)
+	delete(f.containers, container.Name)
+	return nil
+}
+
+func (f *fakeRuntime) Exec(ctx context.Context, id string, cmd []string, stdout, stderr io.Writer) (int, error) {
+	f.mu.Lock()
+	container, err := f.find(id)
+	if err == nil {
+		f.record("exec %s %s", container.Name, strings.Join(cmd, " "))
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return -1, err
+	}
+	if f.exec == nil {
+		return 0, nil
+	}
+	return f.exec(container.Name, cmd, stdout, stderr)
+}
+
+func (f *fakeRuntime) ContainerLogs(ctx context.Context, id string, opts LogOptions, stdout, stderr io.Writer) error {
+	f.mu.Lock()
+	container, err := f.find(id)
+	logs := ""
+	if err == nil {
+		f.record("logs %s", container.Name)
+		logs = f.logs[container.Name]
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	io.WriteString(stdout, logs)
+	return nil
+}
+
+func (f *fakeRuntime) ListNetworks(ctx context.Context, opts ListOptions) ([]Network, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	networks := []Network{}
+	for _, network := range f.networks {
+		if strings.Contains(network.Name, opts.Name) && matchLabels(network.Labels, opts.Labels) {
+			networks = append(networks, network)
+		}
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+	return networks, nil
+}
+
+func (f *fakeRuntime) CreateNetwork(ctx context.Context, name, subnet string, labels map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("create network %s", name)
+	if _, exists := f.networks[name]; exists {
+		return &apiError{StatusCode: 409, Message: "network with name " + name + " already exists"}
+	}
+	f.networks[name] = Network{ID: name, Name: name, Labels: labels, Subnets: []string{subnet}}
+	return nil
+}
+
+func (f *fakeRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, exists := f.networks[name]; !exists {
+		return &apiError{StatusCode: 404, Message: "network " + name + " not found"}
+	}
+	if err := f.removeErrors[name]; err != nil {
+		return err
+	}
+	f.record("remove network %s", name)
+	delete(f.networks, name)
+	return nil
+}
+
+func (f *fakeRuntime) ListVolumes(ctx context.Context, opts ListOptions) ([]Volume, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	volumes := []Volume{}
+	for _, volume := range f.volumes {
+		if strings.Contains(volume.Name, opts.Name) && matchLabels(volume.Labels, opts.Labels) {
+			volumes = append(volumes, volume)
+		}
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes, nil
+}
+
+func (f *fakeRuntime) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("create volume %s", name)
+	f.volumes[name] = Volume{Name: name, Labels: labels}
+	return nil
+}
+
+func (f *fakeRuntime) RemoveVolume(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, exists := f.volumes[name]; !exists {
+		return &apiError{StatusCode: 404, Message: "get " + name + ": no such volume"}
+	}
+	if err := f.removeErrors[name]; err != nil {
+		return err
+	}
+	f.record("remove volume %s", name)
+	delete(f.volumes, name)
+	return nil
+}
+
+func (f *fakeRuntime) ImageExists(ctx context.Context, ref string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.images[ref], nil
+}
+
+func (f *fakeRuntime) ImageID(ctx context.Context, ref string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.images[ref] {
+		return "", &apiError{StatusCode: 404, Message: "No such image: " + ref}
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(ref))), nil
+}
+
+func (f *fakeRuntime) ImageLabels(ctx context.Context, ref string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.images[ref] {
+		return nil, &apiError{StatusCode: 404, Message: "No such image: " + ref}
+	}
+	return f.imageLabels[ref], nil
+}
+
+func (f *fakeRuntime) BuildImage(ctx context.Context, contextDir, tag string, labels map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("build image %s", tag)
+	f.images[tag] = true
+	f.imageLabels[tag] = labels
+	return nil
+}
+
+func (f *fakeRuntime) PullImage(ctx context.Context, ref string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("pull image %s", ref)
+	f.images[ref] = true
+	return nil
+}
+
+func (f *fakeRuntime) RemoveImage(ctx context.Context, ref string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.removeErrors[ref]; err != nil {
+		return err
+	}
+	f.record("remove image %s", ref)
+	delete(f.images, ref)
+	delete(f.imageLabels, ref)
+	return nil
+}
+
+// fakeDialer echoes SSH commands back, failing the ports listed in failures
+// and answering after the per-port delays
+type fakeDialer struct {
+	mu       sync.Mutex
+	failures map[int]error
+	delays   map[int]time.Duration
+	commands []string
+
+	// starting holds the number of banner probes a port refuses before sshd is up
+	starting map[int]int
+	banners  map[int]int
+
+	// shells records the sessions opened by Shell, which echo like Run and
+	// exit with the status in exitCodes for their port
+	shells     []ShellOptions
+	shellUsers []string
+	exitCodes  map[int]int
+
+	// shell, when set, runs the sessions instead of the echo
+	shell func(target SSHTarget, opts ShellOptions) (int, error)
+}
+
+var _ SSHDialer = (*fakeDialer)(nil)
+
+func (d *fakeDialer) Run(ctx context.Context, target SSHTarget, command string) (string, error) {
+	d.mu.Lock()
+	d.commands = append(d.commands, fmt.Sprintf("%s@%s:%d %s", target.User, target.Host, target.Port, command))
+	delay, err := d.delays[target.Port], d.failures[target.Port]
+	d.mu.Unlock()
+
+	time.Sleep(delay)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(command, "echo ") {
+		return strings.Trim(strings.TrimPrefix(command, "echo "), "'"), nil
+	}
+	return "", nil
+}
+
+func (d *fakeDialer) Banner(ctx context.Context, target SSHTarget) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.banners == nil {
+		d.banners = map[int]int{}
+	}
+	d.banners[target.Port]++
+	if err := d.failures[target.Port]; err != nil {
+		return "", err
+	}
+	if d.banners[target.Port] <= d.starting[target.Port] {
+		return "", &SSHError{Reason: reasonHandshake, Err: errors.New("EOF")}
+	}
+	return "SSH-2.0-OpenSSH_9.6", nil
+}
+
+func (d *fakeDialer) Shell(ctx context.Context, target SSHTarget, opts ShellOptions) (int, error) {
+	d.mu.Lock()
+	if err := d.failures[target.Port]; err != nil {
+		d.mu.Unlock()
+		return 0, err
+	}
+	d.shells = append(d.shells, opts)
+	d.shellUsers = append(d.shellUsers, fmt.Sprintf("%s:%s@%d", target.User, target.Password, target.Port))
+	shell := d.shell
+	d.mu.Unlock()
+
+	if shell != nil {
+		return shell(target, opts)
+	}
+	if text, ok := strings.CutPrefix(opts.Command, "echo "); ok {
+		fmt.Fprintf(opts.Stdout, "%s\n", text)
+	}
+	return d.exitCodes[target.Port], nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// testInventory returns the inventory of a lab with nested spec groups, vars
+// and one of two nodes running
+func testInventory() (*LabSpec, *labInventory) {
+	spec := defaultSpec(defaultLabName, 2)
+	spec.Groups = map[string]GroupSpec{
+		"web":      {Hosts: []string{"lab-01", "lab-02"}, Vars: map[string]any{"http_port": 8080}},
+		"frontend": {Children: []string{"web"}},
+	}
+	spec.Nodes[0].Vars = map[string]any{"role": "primary", "ansible_port": 22}
+	containers := []Container{
+		{Name: "lab-01", State: "running", Labels: map[string]string{labNodeLabel: "lab-01"},
+			Ports: []PortBinding{{HostPort: 2222, ContainerPort: 22, Protocol: "tcp"}}},
+		{Name: "lab-02", State: "exited", Labels: map[string]string{labNodeLabel: "lab-02"}},
+	}
+	return spec, buildInventory(spec, containers)
+}
+
+func TestInventoryScriptList(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "exited", 2223)
+	rt.addContainer(defaultLabName, "lab-03", "running", 2224)
+	spec := defaultSpec(defaultLabName, 3)
+	spec.Groups = map[string]GroupSpec{"web": {Hosts: []string{"lab-01", "lab-02"}}}
+
+	if err := app.inventoryScript(context.Background(), spec, ""); err != nil {
+		t.Fatalf("inventoryScript --list unexpected error: %v", err)
+	}
+	var list struct {
+		All         inventoryGroup `json:"all"`
+		Environment inventoryGroup `json:"lab_environment"`
+		Nodes       inventoryGroup `json:"lab_nodes"`
+		Web         inventoryGroup `json:"web"`
+		Meta        struct {
+			HostVars map[string]map[string]any `json:"hostvars"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &list); err != nil {
+		t.Fatalf("--list output is not JSON: %v\n%s", err, out)
+	}
+
+	if !slices.Equal(list.Nodes.Hosts, []string{"lab-01", "lab-03"}) || list.Nodes.Vars["lab_environment"] != defaultLabName {
+		t.Errorf("lab_nodes = %+v, expected the running nodes and the lab vars", list.Nodes)
+	}
+	if !slices.Equal(list.Web.Hosts, []string{"lab-01"}) || !slices.Contains(list.Environment.Children, "web") {
+		t.Errorf("web = %+v, children = %v; expected the running members of the spec group", list.Web, list.Environment.Children)
+	}
+	if !slices.Contains(list.All.Children, "lab_environment") {
+		t.Errorf("all children = %v, expected lab_environment", list.All.Children)
+	}
+	if vars := list.Meta.HostVars["lab-03"]; vars["ansible_port"] != float64(2224) || vars["ansible_user"] != defaultUser {
+		t.Errorf("hostvars of lab-03 = %v, expected port 2224", vars)
+	}
+	if _, ok := list.Meta.HostVars["lab-02"]; ok {
+		t.Errorf("hostvars should only cover running nodes: %v", list.Meta.HostVars)
+	}
+}
+
+func TestInventoryScriptHost(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	spec := defaultSpec(defaultLabName, 2)
+
+	if err := app.inventoryScript(context.Background(), spec, "lab-01"); err != nil {
+		t.Fatalf("inventoryScript --host unexpected error: %v", err)
+	}
+	var vars map[string]any
+	if err := json.Unmarshal(out.Bytes(), &vars); err != nil {
+		t.Fatalf("--host output is not JSON: %v\n%s", err, out)
+	}
+	if vars["ansible_port"] != float64(2222) || vars["container_name"] != "lab-01" || vars["ansible_ssh_pass"] != spec.User.Password {
+		t.Errorf("vars = %v, expected the connection vars of lab-01", vars)
+	}
+
+	out.Reset()
+	if err := app.inventoryScript(context.Background(), spec, "lab-02"); err != nil {
+		t.Fatalf("inventoryScript --host for a node that is not running unexpected error: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "{}" {
+		t.Errorf("--host for a node that is not running = %q, expected {}", out)
+	}
+}
+
+func TestInventoryFormatsMatch(t *testing.T) {
+	spec, inventory := testInventory()
+
+	var fromYAML, fromJSON map[string]any
+	content, err := inventory.render("yaml", nil)
+	if err != nil {
+		t.Fatalf("render yaml unexpected error: %v", err)
+	}
+	if err := yaml.Unmarshal(content, &fromYAML); err != nil {
+		t.Fatalf("yaml inventory does not parse: %v\n%s", err, content)
+	}
+	if content, err = inventory.render("json", nil); err != nil {
+		t.Fatalf("render json unexpected error: %v", err)
+	}
+	if err := json.Unmarshal(content, &fromJSON); err != nil {
+		t.Fatalf("json inventory does not parse: %v\n%s", err, content)
+	}
+	// JSON numbers decode as float64, so compare both through JSON
+	normalized, _ := json.Marshal(fromYAML)
+	json.Unmarshal(normalized, &fromYAML)
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Errorf("yaml and json inventories differ:\n%v\n%v", fromYAML, fromJSON)
+	}
+
+	ini, err := inventory.render("ini", nil)
+	if err != nil {
+		t.Fatalf("render ini unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"[lab_nodes]\nlab-01 ansible_host=localhost ansible_port=2222 ansible_ssh_common_args='-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null' ansible_ssh_pass=" + spec.User.Password,
+		" role=primary ssh_port=2222\n",
+		"[lab_environment:children]\nlab_nodes\nfrontend\n",
+		"[frontend:children]\nweb\n",
+		"[web]\nlab-01\n\n[web:vars]\nhttp_port=8080\n",
+		"lab_sudo_enabled=True\n",
+	} {
+		if !strings.Contains(string(ini), expected) {
+			t.Errorf("ini inventory missing %q:\n%s", expected, ini)
+		}
+	}
+	if strings.Contains(string(ini), "[lab_environment]\n") {
+		t.Errorf("ini inventory should not have an empty host section for lab_environment:\n%s", ini)
+	}
+	if _, err := inventory.render("ini", []byte("vault")); err == nil {
+		t.Errorf("render ini should reject a vault password")
+	}
+
+	// A group with vars but no running hosts still needs its section
+	spec.Groups["db"] = GroupSpec{Hosts: []string{"lab-02"}, Vars: map[string]any{"db_port": 5432}}
+	ini, _ = buildInventory(spec, nil).render("ini", nil)
+	if !strings.Contains(string(ini), "\n[db]\n\n[db:vars]\ndb_port=5432\n") {
+		t.Errorf("ini inventory should define db before its vars:\n%s", ini)
+	}
+}
+
+func TestWriteInventoryDir(t *testing.T) {
+	spec, inventory := testInventory()
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "host_vars"), 0700)
+	os.WriteFile(filepath.Join(dir, "host_vars", "lab-09.yml"), []byte("# LAB Ansible Inventory (Generated)\nssh_port: 2230\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "host_vars", "custom.yml"), []byte("owner: me\n"), 0600)
+
+	password := []byte("vault-secret")
+	if err := inventory.writeInventoryDir(dir, password); err != nil {
+		t.Fatalf("writeInventoryDir unexpected error: %v", err)
+	}
+
+	var hosts map[string]any
+	data, _ := os.ReadFile(filepath.Join(dir, "hosts.yml"))
+	if err := yaml.Unmarshal(data, &hosts); err != nil || strings.Contains(string(data), "ansible_port") {
+		t.Errorf("hosts.yml should only hold the groups (%v):\n%s", err, data)
+	}
+
+	var hostVars map[string]any
+	data, _ = os.ReadFile(filepath.Join(dir, "host_vars", "lab-01.yml"))
+	if err := yaml.Unmarshal(data, &hostVars); err != nil || hostVars["ansible_port"] != 2222 {
+		t.Errorf("host_vars/lab-01.yml = %v (%v), expected the vars of lab-01", hostVars, err)
+	}
+
+	var groupVars yaml.Node
+	data, _ = os.ReadFile(filepath.Join(dir, "group_vars", "lab_nodes.yml"))
+	if err := yaml.Unmarshal(data, &groupVars); err != nil {
+		t.Fatalf("group_vars/lab_nodes.yml does not parse: %v", err)
+	}
+	vars, found := groupVars.Content[0].Content, false
+	for i := 0; i+1 < len(vars); i += 2 {
+		if vars[i].Value == "lab_user_password" {
+			found = true
+			if plaintext, err := vaultDecrypt(vars[i+1].Value, password); vars[i+1].Tag != "!vault" || err != nil || string(plaintext) != spec.User.Password {
+				t.Errorf("lab_user_password = %+v, expected the vault-encrypted password", vars[i+1])
+			}
+		}
+	}
+	if !found {
+		t.Errorf("group_vars/lab_nodes.yml is missing lab_user_password:\n%s", data)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "host_vars", "lab-09.yml")); !os.IsNotExist(err) {
+		t.Errorf("generated vars of a node that is gone should be removed, stat: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "host_vars", "custom.yml")); err != nil {
+		t.Errorf("files not written by lab should be kept: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// labKeyFile is the name of the lab's SSH private key in its state directory;
+// the public key sits next to it with a .pub suffix
+const labKeyFile = "id_ed25519"
+
+// labKeyPath returns the path of the private key of lab
+func (a *App) labKeyPath(lab string) string {
+	return filepath.Join(a.labDir(lab), labKeyFile)
+}
+
+// loadLabKey points spec at the lab's SSH key when one was generated
+func (a *App) loadLabKey(spec *LabSpec) error {
+	if a.StateDir == "" {
+		return nil
+	}
+	path := a.labKeyPath(spec.Name)
+	public, err := os.ReadFile(path + ".pub")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read SSH key of lab %s: %w", spec.Name, err)
+	}
+	spec.keyFile, spec.authorizedKey = path, strings.TrimSpace(string(public))
+	return nil
+}
+
+// ensureLabKey generates an ed25519 keypair for the lab unless it has one, so
+// nodes created afterwards authorize it for the lab user and root
+func (a *App) ensureLabKey(spec *LabSpec) error {
+	if a.StateDir == "" || spec.keyFile != "" {
+		return nil
+	}
+
+	private, public, err := generateKeyPair("lab-" + spec.Name)
+	if err != nil {
+		return fmt.Errorf("failed to generate SSH key of lab %s: %w", spec.Name, err)
+	}
+	path := a.labKeyPath(spec.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to save SSH key of lab %s: %w", spec.Name, err)
+	}
+	if err := writeFileAtomic(path, private, 0600); err != nil {
+		return fmt.Errorf("failed to save SSH key of lab %s: %w", spec.Name, err)
+	}
+	if err := writeFileAtomic(path+".pub", public, 0644); err != nil {
+		return fmt.Errorf("failed to save SSH key of lab %s: %w", spec.Name, err)
+	}
+
+	fmt.Fprintf(a.Out, "%s Generated SSH key %s\n", cyan("🔑"), path)
+	spec.keyFile, spec.authorizedKey = path, strings.TrimSpace(string(public))
+	return nil
+}
+
+// generateKeyPair returns a new ed25519 private key in OpenSSH format and its
+// public key as an authorized_keys line
+func generateKeyPair(comment string) (private, public []byte, err error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, comment)
+	if err != nil {
+		return nil, nil, err
+	}
+	sshPublic, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublic))) + " " + comment + "\n"
+	return pem.EncodeToMemory(block), []byte(line), nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestEnsureLabKey(t *testing.T) {
+	app, _, _, _ := newTestApp()
+	app.StateDir = t.TempDir()
+	spec := defaultSpec(defaultLabName, 1)
+
+	if err := app.ensureLabKey(spec); err != nil {
+		t.Fatalf("ensureLabKey unexpected error: %v", err)
+	}
+	keyFile := filepath.Join(app.StateDir, defaultLabName, labKeyFile)
+	if spec.keyFile != keyFile {
+		t.Errorf("keyFile = %q, expected %q", spec.keyFile, keyFile)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("private key should be saved with mode 0600: %v, %v", info, err)
+	}
+
+	data, _ := os.ReadFile(keyFile)
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		t.Fatalf("private key does not parse: %v", err)
+	}
+	authorized, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(spec.authorizedKey))
+	if err != nil || string(authorized.Marshal()) != string(signer.PublicKey().Marshal()) || comment != "lab-lab" {
+		t.Errorf("authorized key %q does not match the private key: %v", spec.authorizedKey, err)
+	}
+
+	// A second run and a fresh spec reuse the same key
+	if err := app.ensureLabKey(spec); err != nil {
+		t.Fatalf("ensureLabKey unexpected error: %v", err)
+	}
+	loaded := defaultSpec(defaultLabName, 1)
+	if err := app.applyState(loaded); err != nil {
+		t.Fatalf("applyState unexpected error: %v", err)
+	}
+	if loaded.keyFile != keyFile || loaded.authorizedKey != spec.authorizedKey {
+		t.Errorf("applyState loaded %q, %q; expected the generated key", loaded.keyFile, loaded.authorizedKey)
+	}
+
+	config := nodeContainerConfig(loaded, loaded.Nodes[0])
+	if !slices.Contains(config.Env, "AUTHORIZED_KEY="+spec.authorizedKey) {
+		t.Errorf("env = %v, expected the lab key to be authorized", config.Env)
+	}
+	if target := app.sshTarget(loaded, 2222); target.KeyFile != keyFile {
+		t.Errorf("sshTarget key = %q, expected the lab key", target.KeyFile)
+	}
+
+	if err := app.removeState(defaultLabName); err != nil {
+		t.Fatalf("removeState unexpected error: %v", err)
+	}
+	if _, err := os.Stat(keyFile); !os.IsNotExist(err) {
+		t.Errorf("removeState should delete the lab key, stat: %v", err)
+	}
+}
+
+func TestPasswordAuthDisabled(t *testing.T) {
+	app, _, _, _ := newTestApp()
+	spec := defaultSpec(defaultLabName, 1)
+	passwordAuth := false
+	spec.User.PasswordAuth = &passwordAuth
+	spec.keyFile = "/home/me/.lab/lab/id_ed25519"
+
+	if target := app.sshTarget(spec, 2222); target.Password != "" {
+		t.Errorf("sshTarget password = %q, expected key auth only", target.Password)
+	}
+	config := nodeContainerConfig(spec, spec.Nodes[0])
+	if !slices.Contains(config.Env, "PASSWORD_AUTH=false") {
+		t.Errorf("env = %v, expected password auth to be disabled", config.Env)
+	}
+
+	inventory, _ := generateInventoryContent(spec, []Container{{Name: "lab-01", State: "running", Labels: map[string]string{labNodeLabel: "lab-01"},
+		Ports: []PortBinding{{HostPort: 2222, ContainerPort: 22, Protocol: "tcp"}}}}, nil)
+	if !strings.Contains(inventory, "ansible_ssh_private_key_file: /home/me/.lab/lab/id_ed25519") || strings.Contains(inventory, "ansible_ssh_pass") {
+		t.Errorf("inventory should use the lab key instead of the password:\n%s", inventory)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Every container, network and volume created by the tool carries these labels.
+// Commands select resources by label only, so anything without them is never touched.
+const (
+	labNameLabel     = "lab.name"
+	labNodeLabel     = "lab.node"
+	labRoleLabel     = "lab.role"
+	labSpecHashLabel = "lab.spec-hash"
+
+	// labBuildHashLabel is stamped on images the tool builds, see buildContextHash
+	labBuildHashLabel = "lab.build-hash"
+)
+
+// Values of labRoleLabel
+const (
+	roleNode    = "node"
+	roleNetwork = "network"
+	roleVolume  = "volume"
+	roleImage   = "image"
+)
+
+// roleLabels selects the resources of one role in the spec's lab
+func roleLabels(spec *LabSpec, role string) map[string]string {
+	return map[string]string{labNameLabel: spec.Name, labRoleLabel: role}
+}
+
+// allNodeLabels selects the node containers of every lab
+func allNodeLabels() map[string]string {
+	return map[string]string{labNameLabel: "", labRoleLabel: roleNode}
+}
+
+// ownerLabels are stamped on a resource when it is created; node is empty for
+// resources shared by the whole lab
+func ownerLabels(spec *LabSpec, role, node string) map[string]string {
+	labels := map[string]string{
+		labNameLabel:     spec.Name,
+		labRoleLabel:     role,
+		labSpecHashLabel: specHash(spec),
+	}
+	if node != "" {
+		labels[labNodeLabel] = node
+	}
+	return labels
+}
+
+// imageLabels are stamped on an image the tool builds from a context with the given hash
+func imageLabels(buildHash string) map[string]string {
+	return map[string]string{labRoleLabel: roleImage, labBuildHashLabel: buildHash}
+}
+
+// specHash fingerprints the resolved spec, so resources created from an older
+// version of the spec can be told apart
+func specHash(spec *LabSpec) string {
+	// Generated passwords live in the lab state and change when rotated
+	hashed := *spec
+	if spec.User.generatedPassword {
+		hashed.User.Password = ""
+	}
+	if spec.User.generatedRootPassword {
+		hashed.User.RootPassword = ""
+	}
+	data, _ := yaml.Marshal(&hashed)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultLockTimeout is how long a command waits for another command working on the same lab
+const defaultLockTimeout = 2 * time.Minute
+
+// lockFile is the name of the lock file kept in each lab's state directory
+const lockFile = "lock"
+
+// lockPollInterval is how often a waiting command retries the lock
+var lockPollInterval = 100 * time.Millisecond
+
+// lockLab takes the exclusive lock of a lab so that commands changing it never
+// run at the same time. When another command holds the lock it waits up to
+// timeout for it; a zero timeout fails at once. The returned function releases
+// the lock.
+func (a *App) lockLab(ctx context.Context, lab, command string, timeout time.Duration) (func(), error) {
+	if a.StateDir == "" {
+		return func() {}, nil
+	}
+
+	dir := a.labDir(lab)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to lock lab %s: %w", lab, err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock lab %s: %w", lab, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock lab %s: %w", lab, err)
+		}
+
+		holder := lockHolder(file)
+		if !time.Now().Before(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("lab %s is busy (%s) - try again when it finishes or raise --lock-timeout", lab, holder)
+		}
+		if !waiting {
+			fmt.Fprintf(a.Out, "%s Waiting for another command on lab %s to finish (%s)...\n", yellow("⏳"), lab, holder)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	// Tell waiting commands who holds the lock
+	file.Truncate(0)
+	file.WriteAt([]byte(fmt.Sprintf("pid %d: %s\n", os.Getpid(), command)), 0)
+
+	return func() {
+		file.Truncate(0)
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// lockHolder describes the command holding a lock file
+func lockHolder(file *os.File) string {
+	buf := make([]byte, 128)
+	n, _ := file.ReadAt(buf, 0)
+	if holder := strings.TrimSpace(string(buf[:n])); holder != "" {
+		return holder
+	}
+	return "held by another process"
+}
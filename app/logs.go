@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logSourceEntrypoint names the output of a node's entrypoint in merged logs
+const logSourceEntrypoint = "entrypoint"
+
+// serviceLogDir is where the systemctl replacement in the node image writes
+// the output of each service
+const serviceLogDir = "/var/log/journal"
+
+// logFormats lists the supported `logs --output` values
+var logFormats = []string{"json"}
+
+// logSettle is how long followed lines are held back, so that lines from
+// slower nodes are still sorted in before they are printed
+var logSettle = 250 * time.Millisecond
+
+// logsOptions controls which logs `lab logs` merges
+type logsOptions struct {
+	Nodes    string   // comma-separated node names or glob patterns, empty for all
+	Group    string   // spec group whose nodes are selected
+	Services []string // services or absolute log file paths read inside the nodes
+	Follow   bool
+	Since    time.Time
+	JSON     bool // one JSON object per line instead of prefixed text
+}
+
+// logLine is one line of a node's logs
+type logLine struct {
+	Time   time.Time `json:"time"`
+	Node   string    `json:"node"`
+	Source string    `json:"source"`
+	Line   string    `json:"line"`
+
+	seq int // arrival order, keeps lines with the same time in order
+}
+
+// parseSince reads --since as a duration back from now or an RFC 3339 time
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("--since must be a duration such as 10m or an RFC 3339 time, not %q", value)
+}
+
+// serviceLogFile returns the log file read for a --service value: absolute
+// paths are used as they are, and unit names map to their service log
+func serviceLogFile(service string) string {
+	if strings.HasPrefix(service, "/") {
+		return service
+	}
+	if !strings.Contains(service, ".") {
+		service += ".service"
+	}
+	return serviceLogDir + "/" + service + ".log"
+}
+
+// parseLogTime reads the timestamp a log file line starts with: RFC 3339,
+// "2006-01-02 15:04:05" or syslog's "Jan _2 15:04:05", the last two in UTC,
+// the time zone of the node image
+func parseLogTime(line string, now time.Time) (time.Time, bool) {
+	if field, _, ok := strings.Cut(line, " "); ok {
+		if t, err := time.Parse(time.RFC3339Nano, field); err == nil {
+			return t, true
+		}
+	}
+	if len(line) >= 19 {
+		end := 19
+		for end < len(line) && (line[end] == '.' || line[end] == ',' || (line[end] >= '0' && line[end] <= '9')) {
+			end++
+		}
+		if t, err := time.Parse(time.DateTime, line[:end]); err == nil {
+			return t, true
+		}
+	}
+	if len(line) >= 15 {
+		if t, err := time.Parse(time.Stamp, line[:15]); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// logCollector gathers the lines of all sources for sorting
+type logCollector struct {
+	mu    sync.Mutex
+	lines []logLine
+	seq   int
+	since time.Time
+}
+
+func (c *logCollector) add(line logLine) {
+	if !c.since.IsZero() && line.Time.Before(c.since) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	line.seq = c.seq
+	c.seq++
+	c.lines = append(c.lines, line)
+}
+
+// take removes and returns the lines written before cutoff in time order; a
+// zero cutoff takes every line
+func (c *logCollector) take(cutoff time.Time) []logLine {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sort.SliceStable(c.lines, func(i, j int) bool {
+		if !c.lines[i].Time.Equal(c.lines[j].Time) {
+			return c.lines[i].Time.Before(c.lines[j].Time)
+		}
+		return c.lines[i].seq < c.lines[j].seq
+	})
+	n := len(c.lines)
+	if !cutoff.IsZero() {
+		n = sort.Search(len(c.lines), func(i int) bool { return c.lines[i].Time.After(cutoff) })
+	}
+	taken := append([]logLine(nil), c.lines[:n]...)
+	c.lines = c.lines[n:]
+	return taken
+}
+
+// lineWriter calls emit for every complete line written to it
+type lineWriter struct {
+	mu   sync.Mutex
+	line []byte
+	emit func(string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.emit(string(bytes.TrimRight(w.line[:i], "\r")))
+		w.line = w.line[i+1:]
+	}
+}
+
+// Flush emits a final line that did not end with a newline
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.line) > 0 {
+		w.emit(string(w.line))
+		w.line = nil
+	}
+}
+
+// showLogs merges the entrypoint output and the logs of the selected services
+// of every selected node into one stream ordered by time. With opts.Follow it
+// keeps printing new lines until ctx ends.
+func (a *App) showLogs(ctx context.Context, spec *LabSpec, opts logsOptions) error {
+	containers, err := a.selectNodes(ctx, spec, opts.Nodes, opts.Group)
+	if err != nil {
+		return err
+	}
+
+	collector := &logCollector{since: opts.Since}
+	colors := map[string]func(a ...interface{}) string{}
+	width := 0
+	for i, container := range containers {
+		node := spec.nodeName(container)
+		colors[node] = nodeColors[i%len(nodeColors)]
+		width = max(width, len(node))
+		for _, service := range opts.Services {
+			width = max(width, len(node)+1+len(service))
+		}
+	}
+
+	var mu sync.Mutex
+	var failures []string
+	fail := func(node, source string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, fmt.Sprintf("%s %s (%v)", node, source, err))
+	}
+
+	var wg sync.WaitGroup
+	for _, container := range containers {
+		node := spec.nodeName(container)
+		wg.Add(1)
+		go func(container Container) {
+			defer wg.Done()
+			writer := &lineWriter{emit: func(text string) {
+				line := logLine{Node: node, Source: logSourceEntrypoint, Line: text}
+				if field, rest, ok := strings.Cut(text, " "); ok {
+					if t, err := time.Parse(time.RFC3339Nano, field); err == nil {
+						line.Time, line.Line = t, rest
+					}
+				}
+				if line.Time.IsZero() {
+					line.Time = time.Now()
+				}
+				collector.add(line)
+			}}
+			err := a.Runtime.ContainerLogs(ctx, container.ID, LogOptions{Follow: opts.Follow, Since: opts.Since}, writer, writer)
+			writer.Flush()
+			if err != nil {
+				fail(node, logSourceEntrypoint, err)
+			}
+		}(container)
+
+		for _, service := range opts.Services {
+			wg.Add(1)
+			go func(container Container, service string) {
+				defer wg.Done()
+				writer := &lineWriter{emit: func(text string) {
+					t, ok := parseLogTime(text, time.Now())
+					if !ok {
+						t = time.Now()
+					}
+					collector.add(logLine{Time: t, Node: node, Source: service, Line: text})
+				}}
+				cmd := []string{"tail", "-n", "+1", serviceLogFile(service)}
+				if opts.Follow {
+					cmd = []string{"tail", "-n", "+1", "-F", serviceLogFile(service)}
+				}
+				var stderr lockedBuffer
+				code, err := a.Runtime.Exec(ctx, container.ID, cmd, writer, &stderr)
+				writer.Flush()
+				switch {
+				case err != nil && ctx.Err() == nil:
+					fail(node, service, err)
+				case code != 0 && ctx.Err() == nil:
+					mu.Lock()
+					fmt.Fprintf(a.errOut(), "%s %s: no log for %s at %s\n", yellow("⚠️"), node, service, serviceLogFile(service))
+					mu.Unlock()
+				}
+			}(container, service)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var printErr error
+	printLines := func(lines []logLine) {
+		for _, line := range lines {
+			if printErr != nil {
+				return
+			}
+			if opts.JSON {
+				line.Time = line.Time.UTC()
+				printErr = json.NewEncoder(a.Out).Encode(line)
+				continue
+			}
+			label := line.Node
+			if line.Source != logSourceEntrypoint {
+				label += " " + line.Source
+			}
+			prefix := colors[line.Node](fmt.Sprintf("%-*s |", width, label))
+			_, printErr = fmt.Fprintf(a.Out, "%s %s\n", prefix, line.Line)
+		}
+	}
+
+	if opts.Follow {
+		ticker := time.NewTicker(logSettle)
+		defer ticker.Stop()
+	follow:
+		for {
+			select {
+			case <-done:
+				break follow
+			case <-ticker.C:
+				printLines(collector.take(time.Now().Add(-logSettle)))
+			}
+		}
+	} else {
+		<-done
+	}
+	printLines(collector.take(time.Time{}))
+
+	if printErr != nil {
+		return printErr
+	}
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return fmt.Errorf("could not read %d log sources: %s", len(failures), strings.Join(failures, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShowLogsMergesNodesInTimeOrder(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	rt.logs = map[string]string{
+		"lab-01": "2026-10-16T10:00:01.000000000Z booting\n2026-10-16T10:00:04.000000000Z sshd started\n",
+		"lab-02": "2026-10-16T10:00:02.000000000Z booting\n",
+	}
+	rt.exec = func(name string, cmd []string, stdout, stderr io.Writer) (int, error) {
+		if strings.Join(cmd, " ") != "tail -n +1 /var/log/journal/nginx.service.log" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+		if name == "lab-02" {
+			io.WriteString(stderr, "tail: cannot open\n")
+			return 1, nil
+		}
+		io.WriteString(stdout, "2026-10-16 10:00:03,250 nginx listening\n")
+		return 0, nil
+	}
+
+	opts := logsOptions{Services: []string{"nginx"}}
+	if err := app.showLogs(context.Background(), defaultSpec(defaultLabName, 2), opts); err != nil {
+		t.Fatalf("showLogs failed: %v", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, " | ") {
+			lines = append(lines, line)
+		}
+	}
+	expected := []string{
+		"lab-01       | booting",
+		"lab-02       | booting",
+		"lab-01 nginx | 2026-10-16 10:00:03,250 nginx listening",
+		"lab-01       | sshd started",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("merged logs =\n%s\nexpected\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+	if !strings.Contains(out.String(), "lab-02: no log for nginx") {
+		t.Errorf("output should warn about the missing nginx log on lab-02:\n%s", out)
+	}
+}
+
+func TestShowLogsJSON(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	rt.logs = map[string]string{
+		"lab-01": "2026-10-16T10:00:01Z old\n2026-10-16T10:00:05Z new\n",
+		"lab-02": "2026-10-16T10:00:06Z other node\n",
+	}
+
+	since := time.Date(2026, 10, 16, 10, 0, 2, 0, time.UTC)
+	opts := logsOptions{Nodes: "lab-01", Since: since, JSON: true}
+	if err := app.showLogs(context.Background(), defaultSpec(defaultLabName, 2), opts); err != nil {
+		t.Fatalf("showLogs failed: %v", err)
+	}
+
+	var line logLine
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("output is not one JSON line: %v\n%s", err, out)
+	}
+	expected := logLine{Time: since.Add(3 * time.Second), Node: "lab-01", Source: logSourceEntrypoint, Line: "new"}
+	if line != expected {
+		t.Errorf("JSON line = %+v, expected %+v", line, expected)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Time
+		ok       bool
+	}{
+		{"", time.Time{}, true},
+		{"10m", now.Add(-10 * time.Minute), true},
+		{"2026-10-16T08:30:00Z", time.Date(2026, 10, 16, 8, 30, 0, 0, time.UTC), true},
+		{"yesterday", time.Time{}, false},
+		{"-5m", time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, err := parseSince(test.value, now)
+		if (err == nil) != test.ok || !got.Equal(test.expected) {
+			t.Errorf("parseSince(%q) = %v, %v; expected %v (ok %v)", test.value, got, err, test.expected, test.ok)
+		}
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	now := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		line     string
+		expected time.Time
+	}{
+		{"2026-01-01T10:00:00.5Z started", time.Date(2026, 1, 1, 10, 0, 0, 5e8, time.UTC)},
+		{"2026-01-01 10:00:00,250 INFO started", time.Date(2026, 1, 1, 10, 0, 0, 25e7, time.UTC)},
+		{"Jan  1 10:00:00 lab-01 sshd[42]: started", time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{"Dec 31 23:00:00 lab-01 cron: last year", time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)},
+		{"started without a timestamp", time.Time{}},
+	}
+	for _, test := range tests {
+		got, ok := parseLogTime(test.line, now)
+		if ok != !test.expected.IsZero() || !got.Equal(test.expected) {
+			t.Errorf("parseLogTime(%q) = %v, %v; expected %v", test.line, got, ok, test.expected)
+		}
+	}
+}
+
+func TestServiceLogFile(t *testing.T) {
+	for service, expected := range map[string]string{
+		"nginx":           "/var/log/journal/nginx.service.log",
+		"backup.timer":    "/var/log/journal/backup.timer.log",
+		"/var/log/syslog": "/var/log/syslog",
+	} {
+		if got := serviceLogFile(service); got != expected {
+			t.Errorf("serviceLogFile(%q) = %q, expected %q", service, got, expected)
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,298 +23,997 @@ import (
 )
 
 var (
-	green  = color.New(color.FgGreen).SprintFunc()
-	red    = color.New(color.FgRed).SprintFunc()
-	yellow = color.New(color.FgYellow).SprintFunc()
-	blue   = color.New(color.FgBlue).SprintFunc()
-	cyan   = color.New(color.FgCyan).SprintFunc()
-	bold   = color.New(color.Bold).SprintFunc()
+	plainYAMLPattern = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./@+=-]*$`)
+	yamlKeywords     = map[string]bool{"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true, "null": true}
 )
 
+var (
+	green   = color.New(color.FgGreen).SprintFunc()
+	red     = color.New(color.FgRed).SprintFunc()
+	yellow  = color.New(color.FgYellow).SprintFunc()
+	blue    = color.New(color.FgBlue).SprintFunc()
+	cyan    = color.New(color.FgCyan).SprintFunc()
+	magenta = color.New(color.FgMagenta).SprintFunc()
+	bold    = color.New(color.Bold).SprintFunc()
+)
+
+// App holds the dependencies shared by every command, so commands can be
+// exercised against fake runtimes and SSH dialers in tests
+type App struct {
+	Runtime Runtime
+	SSH     SSHDialer
+	In      io.Reader // answers to confirmation prompts and input of interactive sessions
+	Out     io.Writer
+	Err     io.Writer // standard error of remote commands; nil writes it to Out
+
+	// Ansible runs an Ansible ping against an inventory file; nil when Ansible is not installed
+	Ansible func(ctx context.Context, inventoryPath string) (string, error)
+
+	// WaitTimeout bounds the wait for nodes to become ready after init and start; zero skips it
+	WaitTimeout time.Duration
+
+	// StateDir holds a directory per lab with its state file; empty keeps no state
+	StateDir string
+
+	// PortFree reports whether a host port can be published; nil checks by binding it
+	PortFree func(port int) bool
+
+	// ReadinessProbe is a command that must succeed over SSH before a node is
+	// ready; when empty the SSH banner is enough
+	ReadinessProbe string
+
+	// IdentityFile is an SSH private key offered before the password
+	IdentityFile string
+
+	// ShowSecrets prints passwords in connection details instead of hiding them
+	ShowSecrets bool
+}
+
+// options holds the parsed command line flags
+type options struct {
+	specFile   string
+	runtime    string
+	lab        string
+	containers int
+	dryRun     bool
+	yes        bool
+
+	identity       string
+	connectTimeout time.Duration
+	commandTimeout time.Duration
+	parallel       int
+	output         string
+
+	waitTimeout time.Duration
+	probe       string
+	portRange   string
+	lockTimeout time.Duration
+
+	user         string
+	forwardAgent bool
+
+	nodes   string
+	group   string
+	via     string
+	grouped bool
+
+	// groups holds the init --group definitions, NAME=SEL
+	groups []string
+
+	follow   bool
+	since    string
+	services string
+
+	showSecrets bool
+	rotate      bool
+
+	vaultPasswordFile string
+	format            string
+	list              bool
+	host              string
+
+	// args holds the positional arguments, including everything after --
+	args []string
+
+	// set records the flags given explicitly on the command line
+	set map[string]bool
+}
+
 func main() {
-	printHeader()
+	// Run as lab-inventory, the binary is an Ansible inventory script
+	command, args := "inventory", os.Args[1:]
+	script := filepath.Base(os.Args[0]) == inventoryScriptName
+	if !script {
+		if len(os.Args) < 2 {
+			printHeader(os.Stdout)
+			printUsage(os.Stdout)
+			return
+		}
+		command, args = os.Args[1], os.Args[2:]
+	}
+
+	// Parse flags for commands that support them
+	opts := options{set: map[string]bool{}}
+	flagSet := flag.NewFlagSet(command, flag.ExitOnError)
+	flagSet.StringVar(&opts.specFile, "file", defaultSpecFile, "Lab spec file (default: lab.yaml)")
+	flagSet.StringVar(&opts.specFile, "f", defaultSpecFile, "Lab spec file (short flag)")
+	flagSet.StringVar(&opts.lab, "lab", "", "Lab name (default: name in the spec, or lab)")
+	flagSet.StringVar(&opts.runtime, "runtime", "", "Container runtime: docker, podman or nerdctl (default: auto-detect)")
+	switch command {
+	case "init", "start", "stop", "clean":
+		flagSet.DurationVar(&opts.lockTimeout, "lock-timeout", defaultLockTimeout, "How long to wait for another command on the same lab (0 fails at once)")
+	}
+	switch command {
+	case "init", "start":
+		flagSet.DurationVar(&opts.waitTimeout, "wait-timeout", defaultWaitTimeout, "How long to wait for nodes to become ready (0 skips the wait)")
+		flagSet.StringVar(&opts.probe, "probe", "", "Command that must succeed over SSH before a node is ready (default: wait for the SSH banner)")
+		flagSet.StringVar(&opts.portRange, "port-range", "", "Host ports SSH may be published on, e.g. 2222-2999 (default: ports.ssh_range)")
+	}
+	switch command {
+	case "init", "start", "status":
+		flagSet.BoolVar(&opts.showSecrets, "show-secrets", false, "Show passwords in the connection details")
+	}
+	switch command {
+	case "init":
+		flagSet.IntVar(&opts.containers, "containers", 2, "Number of containers to create (default: 2)")
+		flagSet.IntVar(&opts.containers, "c", 2, "Number of containers to create (short flag)")
+		flagSet.Func("group", "Put nodes in an inventory group, e.g. web=1-3 (repeatable)", func(value string) error {
+			opts.groups = append(opts.groups, value)
+			return nil
+		})
+	case "clean":
+		flagSet.BoolVar(&opts.dryRun, "dry-run", false, "List the resources that would be removed without removing them")
+		flagSet.BoolVar(&opts.yes, "yes", false, "Do not ask for confirmation")
+		flagSet.BoolVar(&opts.yes, "y", false, "Do not ask for confirmation (short flag)")
+	case "ssh":
+		flagSet.BoolVar(&opts.forwardAgent, "forward-agent", false, "Forward the local SSH agent to the node")
+		flagSet.BoolVar(&opts.forwardAgent, "A", false, "Forward the local SSH agent (short flag)")
+	case "exec":
+		flagSet.StringVar(&opts.nodes, "nodes", "", "Comma-separated node names or glob patterns (default: all nodes)")
+		flagSet.StringVar(&opts.group, "group", "", "Run on the nodes of this spec group")
+		flagSet.StringVar(&opts.via, "via", viaSSH, "Reach the nodes over ssh or with container exec")
+		flagSet.BoolVar(&opts.grouped, "grouped", false, "Print identical output once for all nodes that produced it")
+		flagSet.IntVar(&opts.parallel, "parallel", defaultParallel, "Number of nodes to run on at the same time")
+	case "status", "test":
+		flagSet.StringVar(&opts.nodes, "nodes", "", "Comma-separated node names or glob patterns (default: all nodes)")
+		flagSet.StringVar(&opts.group, "group", "", "Only the nodes of this spec group")
+	case "inventory":
+		flagSet.StringVar(&opts.vaultPasswordFile, "vault-password-file", "", "Encrypt the passwords in the inventory with this Ansible vault password")
+		flagSet.StringVar(&opts.format, "format", "yaml", "Inventory layout: yaml, ini, json or dir, or salt, pyinfra, nornir, bolt or knife for other tools")
+		flagSet.StringVar(&opts.output, "output", "", "Path to write the inventory to, - for stdout (default: inventory.yml, .ini, .json, inventory/ or the tool's file)")
+		flagSet.BoolVar(&opts.list, "list", false, "Print the inventory as JSON for Ansible instead of writing inventory.yml")
+		flagSet.StringVar(&opts.host, "host", "", "Print the vars of one host as JSON for Ansible")
+	case "ssh-config":
+		flagSet.StringVar(&opts.output, "output", "", "Path to write the SSH config to, - for stdout (default: ~/.lab/<lab>/ssh_config)")
+	case "credentials":
+		flagSet.BoolVar(&opts.rotate, "rotate", false, "Set new random passwords on every node first")
+	case "logs":
+		flagSet.StringVar(&opts.group, "group", "", "Show the logs of the nodes of this spec group")
+		flagSet.BoolVar(&opts.follow, "follow", false, "Keep printing new log lines until interrupted")
+		flagSet.StringVar(&opts.since, "since", "", "Only show lines since a duration ago (10m) or an RFC 3339 time")
+		flagSet.StringVar(&opts.services, "service", "", "Comma-separated services or log file paths to read inside the nodes")
+		flagSet.StringVar(&opts.output, "output", "", "Write json lines to stdout instead of prefixed text")
+	}
+	switch command {
+	case "ssh", "exec", "cp":
+		flagSet.StringVar(&opts.user, "user", "", "Log in as this user, e.g. root (default: the lab user)")
+		flagSet.StringVar(&opts.user, "u", "", "User (short flag)")
+	}
+	switch command {
+	case "test", "ssh", "exec", "cp":
+		flagSet.StringVar(&opts.identity, "identity", "", "SSH private key to use instead of the lab key")
+		flagSet.StringVar(&opts.identity, "i", "", "SSH private key (short flag)")
+		flagSet.DurationVar(&opts.connectTimeout, "connect-timeout", defaultConnectTimeout, "Timeout for connecting and authenticating")
+	}
+	switch command {
+	case "test":
+		flagSet.DurationVar(&opts.commandTimeout, "command-timeout", defaultCommandTimeout, "Timeout for the test command")
+		flagSet.IntVar(&opts.parallel, "parallel", defaultParallel, "Number of nodes to check at the same time")
+		flagSet.StringVar(&opts.output, "output", "", "Also write a json, junit or tap report to stdout")
+	}
+	opts.args = parseArgs(flagSet, args)
+	flagSet.Visit(func(f *flag.Flag) { opts.set[f.Name] = true })
+
+	// Ansible parses all of an inventory script's stdout as JSON, and runs it
+	// without flags, so the lab can also be chosen with LAB_NAME and LAB_FILE
+	scriptMode := script || opts.list || opts.set["host"]
+	if scriptMode {
+		if !opts.set["lab"] {
+			opts.lab = os.Getenv("LAB_NAME")
+		}
+		if file := os.Getenv("LAB_FILE"); file != "" && !opts.set["file"] && !opts.set["f"] {
+			opts.specFile, opts.set["file"] = file, true
+		}
+	}
 
-	if len(os.Args) < 2 {
-		printUsage()
-		return
+	// Keep stdout clean for a report or the output of a remote session
+	out := io.Writer(os.Stdout)
+	switch {
+	case opts.output != "" && command != "inventory" && command != "ssh-config", opts.output == "-", scriptMode, command == "ssh", command == "exec", command == "logs", command == "credentials":
+		out = os.Stderr
+	}
+	if !scriptMode {
+		printHeader(out)
+	}
+
+	switch command {
+	case "init", "start", "stop", "clean", "status", "inventory", "test", "list", "ssh", "ssh-config", "exec", "cp", "logs", "credentials":
+	default:
+		fmt.Fprintf(out, "%s Unknown command: %s\n", red("❌"), command)
+		printUsage(out)
+		os.Exit(1)
+	}
+	formats := reportFormats
+	if command == "logs" {
+		formats = logFormats
+	}
+	if script && !opts.list && !opts.set["host"] || opts.list && opts.set["host"] {
+		fmt.Fprintf(out, "%s %v\n", red("❌"), errInventoryScriptUsage)
+		os.Exit(2)
+	}
+	if command == "inventory" && !slices.Contains(inventoryFormats, opts.format) {
+		fmt.Fprintf(out, "%s --format must be one of: %s\n", red("❌"), strings.Join(inventoryFormats, ", "))
+		os.Exit(2)
+	}
+	if opts.output != "" && command != "inventory" && command != "ssh-config" && !slices.Contains(formats, opts.output) {
+		fmt.Fprintf(out, "%s --output must be one of: %s\n", red("❌"), strings.Join(formats, ", "))
+		os.Exit(2)
 	}
 
-	command := os.Args[1]
+	if err := run(command, opts, out); err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		fmt.Fprintf(out, "%s %v\n", red("❌"), err)
+		os.Exit(1)
+	}
+}
 
-	// Parse flags for commands that support them
-	var containerCount int
-	if command == "init" {
-		flagSet := flag.NewFlagSet("init", flag.ExitOnError)
-		flagSet.IntVar(&containerCount, "containers", 2, "Number of containers to create (default: 2)")
-		flagSet.IntVar(&containerCount, "c", 2, "Number of containers to create (short flag)")
-		flagSet.Parse(os.Args[2:])
+// parseArgs parses flags given before, between and after positional
+// arguments and returns the positional ones; everything after -- is positional
+func parseArgs(flagSet *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flagSet.Parse(args)
+		rest := flagSet.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// run wires up the real runtime and SSH client and executes command, writing
+// progress to out
+func run(command string, opts options, out io.Writer) error {
+	rt, err := newRuntime(opts.runtime)
+	if err != nil {
+		return err
+	}
+
+	app := &App{
+		Runtime:        rt,
+		SSH:            newNativeDialer(opts.connectTimeout, opts.commandTimeout),
+		In:             os.Stdin,
+		Out:            out,
+		IdentityFile:   opts.identity,
+		StateDir:       defaultStateDir(),
+		WaitTimeout:    opts.waitTimeout,
+		ReadinessProbe: opts.probe,
+		ShowSecrets:    opts.showSecrets,
+	}
+	if _, err := exec.LookPath("ansible"); err == nil {
+		app.Ansible = runAnsiblePing
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// list covers every lab, so it does not need a spec
+	if command == "list" {
+		return app.listLabs(ctx)
+	}
+
+	spec, err := commandSpec(opts)
+	if err != nil {
+		return err
+	}
+	if opts.portRange != "" {
+		if _, _, err := parsePortRange(opts.portRange); err != nil {
+			return fmt.Errorf("--port-range: %w", err)
+		}
+		spec.Ports.SSHRange = opts.portRange
+	}
+
+	// Commands that change the lab wait for each other
+	switch {
+	case command == "init", command == "start", command == "stop", command == "clean", command == "credentials" && opts.rotate:
+		unlock, err := app.lockLab(ctx, spec.Name, command, opts.lockTimeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if err := app.applyState(spec); err != nil {
+		return err
 	}
 
 	switch command {
 	case "init":
-		initLab(containerCount)
+		return app.initLab(ctx, spec)
 	case "start":
-		startLab()
+		return app.startLab(ctx, spec)
 	case "stop":
-		stopLab()
+		return app.stopLab(ctx, spec)
 	case "clean":
-		cleanLab()
+		return app.cleanLab(ctx, spec, opts.dryRun, opts.yes)
 	case "status":
-		showStatus()
+		return app.showStatus(ctx, spec, opts.nodes, opts.group)
 	case "inventory":
-		generateInventory()
+		if opts.list || opts.set["host"] {
+			app.Out, app.Err = os.Stdout, os.Stderr
+			return app.inventoryScript(ctx, spec, opts.host)
+		}
+		if opts.output == "-" {
+			app.Out, app.Err = os.Stdout, os.Stderr
+		}
+		return app.generateInventory(ctx, spec, inventoryOptions{
+			Format:            opts.format,
+			Path:              opts.output,
+			VaultPasswordFile: opts.vaultPasswordFile,
+		})
 	case "test":
-		testConnectivity()
-	default:
-		fmt.Printf("%s Unknown command: %s\n", red("❌"), command)
-		printUsage()
+		return app.testConnectivity(ctx, spec, testOptions{
+			Parallel: opts.parallel,
+			Format:   opts.output,
+			Report:   os.Stdout,
+			Nodes:    opts.nodes,
+			Group:    opts.group,
+		})
+	case "ssh":
+		if len(opts.args) == 0 {
+			return errors.New("usage: ./lab ssh <node> [--user USER] [-A] [-- command]")
+		}
+		app.Out, app.Err = os.Stdout, os.Stderr
+		code, err := app.sshNode(ctx, spec, opts.args[0], opts.user, opts.args[1:], opts.forwardAgent)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return &exitCodeError{Code: code}
+		}
+	case "ssh-config":
+		if opts.output == "-" {
+			app.Out, app.Err = os.Stdout, os.Stderr
+		}
+		return app.writeSSHConfig(ctx, spec, opts.output)
+	case "exec":
+		app.Out, app.Err = os.Stdout, os.Stderr
+		return app.execNodes(ctx, spec, opts.args, execOptions{
+			Nodes:    opts.nodes,
+			Group:    opts.group,
+			Via:      opts.via,
+			User:     opts.user,
+			Parallel: opts.parallel,
+			Grouped:  opts.grouped,
+		})
+	case "cp":
+		if len(opts.args) != 2 {
+			return errors.New("usage: ./lab cp SRC DST (one side node:PATH or group:NAME:PATH)")
+		}
+		return app.copyFiles(ctx, spec, opts.args[0], opts.args[1], opts.user)
+	case "credentials":
+		app.Out, app.Err = os.Stdout, os.Stderr
+		return app.showCredentials(ctx, spec, opts.rotate)
+	case "logs":
+		since, err := parseSince(opts.since, time.Now())
+		if err != nil {
+			return err
+		}
+		var services []string
+		for _, service := range strings.Split(opts.services, ",") {
+			if service = strings.TrimSpace(service); service != "" {
+				services = append(services, service)
+			}
+		}
+		app.Out, app.Err = os.Stdout, os.Stderr
+		return app.showLogs(ctx, spec, logsOptions{
+			Nodes:    strings.Join(opts.args, ","),
+			Group:    opts.group,
+			Services: services,
+			Follow:   opts.follow,
+			Since:    since,
+			JSON:     opts.output == "json",
+		})
 	}
+	return nil
 }
 
-func printHeader() {
-	fmt.Printf("\n%s\n", bold(cyan("🧪 LAB Operations Tool")))
-	fmt.Printf("%s\n", blue("═══════════════════════════"))
+// commandSpec loads the lab spec a command should use. --containers only
+// applies when there is no spec file, so combining the two is rejected.
+func commandSpec(opts options) (*LabSpec, error) {
+	if opts.set["containers"] || opts.set["c"] {
+		if _, err := os.Stat(opts.specFile); err == nil {
+			return nil, fmt.Errorf("--containers cannot be used with %s - edit the nodes in the spec instead", opts.specFile)
+		}
+	}
+	containerCount := opts.containers
+	if containerCount <= 0 {
+		containerCount = 2
+	}
+	spec, err := resolveSpec(opts.specFile, opts.set["file"] || opts.set["f"], opts.lab, containerCount)
+	if err != nil || len(opts.groups) == 0 {
+		return spec, err
+	}
+
+	// init --group defines the groups of a lab without a spec file
+	if spec.source != "" {
+		return nil, fmt.Errorf("--group cannot be used with %s - declare the groups in it instead", spec.source)
+	}
+	spec.Groups = map[string]GroupSpec{}
+	for _, value := range opts.groups {
+		name, hosts, err := spec.parseGroupFlag(value)
+		if err != nil {
+			return nil, err
+		}
+		group := spec.Groups[name]
+		group.Hosts = append(group.Hosts, hosts...)
+		spec.Groups[name] = group
+	}
+	if err := spec.validate("--group"); err != nil {
+		return nil, err
+	}
+	return spec, nil
 }
 
-func printUsage() {
-	fmt.Printf("\n%s\n", bold("Usage: ./lab <command> [options]"))
-	fmt.Printf("\n%s\n", bold("Commands:"))
-	fmt.Printf("  %s      - Initialize lab environment with custom settings\n", green("init"))
-	fmt.Printf("    %s --containers N, -c N  - Number of containers (default: 2)\n", blue("Options:"))
-	fmt.Printf("  %s     - Start existing lab environment\n", cyan("start"))
-	fmt.Printf("  %s      - Stop the lab environment\n", yellow("stop"))
-	fmt.Printf("  %s     - Clean up lab containers and images\n", red("clean"))
-	fmt.Printf("  %s    - Show lab status and connection details\n", blue("status"))
-	fmt.Printf("  %s - Generate Ansible inventory file\n", cyan("inventory"))
-	fmt.Printf("  %s      - Test SSH and Ansible connectivity\n", blue("test"))
-	fmt.Printf("\n%s\n", bold("Examples:"))
-	fmt.Printf("  ./lab init                     # Initialize with 2 containers\n")
-	fmt.Printf("  ./lab init --containers 5      # Initialize with 5 containers\n")
-	fmt.Printf("  ./lab init -c 3                # Initialize with 3 containers\n")
-	fmt.Printf("  ./lab start                    # Start existing lab environment\n")
-	fmt.Println()
+func printHeader(w io.Writer) {
+	fmt.Fprintf(w, "\n%s\n", bold(cyan("🧪 LAB Operations Tool")))
+	fmt.Fprintf(w, "%s\n", blue("═══════════════════════════"))
 }
 
-func initLab(containerCount int) {
-	fmt.Printf("\n%s %s\n", green("🚀"), bold("Initializing LAB environment..."))
-	fmt.Printf("%s\n", blue("═════════════════════════════════════"))
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "\n%s\n", bold("Usage: ./lab <command> [options]"))
+	fmt.Fprintf(w, "\n%s\n", bold("Commands:"))
+	fmt.Fprintf(w, "  %s      - Initialize lab environment with custom settings\n", green("init"))
+	fmt.Fprintf(w, "    %s --containers N, -c N  - Number of containers (default: 2, mutually exclusive with lab.yaml or --file)\n", blue("Options:"))
+	fmt.Fprintf(w, "    %s --group web=1-3  - Put nodes in an inventory group (repeatable, without lab.yaml)\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s     - Start existing lab environment\n", cyan("start"))
+	fmt.Fprintf(w, "    %s --wait-timeout 60s, --probe CMD  - Readiness wait for init and start (0 skips it)\n", blue("Options:"))
+	fmt.Fprintf(w, "    %s --port-range 2222-2999  - Host ports SSH may be published on\n", blue("Options:"))
+	fmt.Fprintf(w, "    %s --lock-timeout 2m  - init, start, stop and clean wait this long for each other (0 fails at once)\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s      - Stop the lab environment\n", yellow("stop"))
+	fmt.Fprintf(w, "  %s     - Clean up lab containers and images\n", red("clean"))
+	fmt.Fprintf(w, "    %s --dry-run  - List what would be removed; --yes, -y  - Skip confirmation\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s    - Show lab status and connection details (--show-secrets to include passwords)\n", blue("status"))
+	fmt.Fprintf(w, "    %s --nodes SEL, --group G  - Only these nodes (also for test)\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s - Generate Ansible inventory file\n", cyan("inventory"))
+	fmt.Fprintf(w, "    %s --vault-password-file FILE  - Write passwords as !vault encrypted strings\n", blue("Options:"))
+	fmt.Fprintf(w, "    %s --format yaml|ini|json|dir, --output PATH  - Inventory layout and where to write it (- for stdout)\n", blue("Options:"))
+	fmt.Fprintf(w, "    %s --format salt|pyinfra|nornir|bolt|knife  - Export the same nodes for Salt SSH, pyinfra, Nornir, Puppet Bolt or knife ssh\n", blue("Options:"))
+	fmt.Fprintf(w, "    %s --list, --host NAME  - Print JSON for Ansible instead (also run as lab-inventory)\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s      - Test SSH and Ansible connectivity\n", blue("test"))
+	fmt.Fprintf(w, "    %s --identity PATH, -i PATH, --connect-timeout 5s, --command-timeout 10s, --parallel N\n", blue("Options:"))
+	fmt.Fprintf(w, "    %s --output json|junit|tap  - Write a test report to stdout, progress to stderr\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s      - List all labs and their state\n", cyan("list"))
+	fmt.Fprintf(w, "  %s       - Open a shell on a node, or run a command after --\n", green("ssh"))
+	fmt.Fprintf(w, "    %s <node> --user USER, -u USER, --forward-agent, -A, --identity PATH\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s - Write a Host block per node for ssh, scp and rsync: Include ~/.lab/<lab>/ssh_config\n", green("ssh-config"))
+	fmt.Fprintf(w, "    %s --output PATH  - Where to write it (- for stdout)\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s      - Run a command on many nodes in parallel: exec [options] -- <command>\n", yellow("exec"))
+	fmt.Fprintf(w, "    %s --nodes SEL, --group G, --via ssh|container, --grouped, --user USER, --parallel N\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s        - Copy files and directories to or from nodes: cp SRC DST\n", cyan("cp"))
+	fmt.Fprintf(w, "    %s node:PATH, nodes*:PATH or group:NAME:PATH on one side, --user USER\n", blue("Options:"))
+	fmt.Fprintf(w, "  %s - Print the lab's passwords, or set new random ones with --rotate\n", magenta("credentials"))
+	fmt.Fprintf(w, "  %s      - Show the merged logs of nodes in time order: logs [nodes]\n", blue("logs"))
+	fmt.Fprintf(w, "    %s --follow, --since 10m, --service NAME|PATH, --group G, --output json\n", blue("Options:"))
+	fmt.Fprintf(w, "\n%s\n", bold("Global Options:"))
+	fmt.Fprintf(w, "  --file PATH, -f PATH   - Lab spec file (default: lab.yaml)\n")
+	fmt.Fprintf(w, "  --lab NAME             - Lab to operate on (default: name in the spec, or lab)\n")
+	fmt.Fprintf(w, "  --runtime NAME         - docker, podman or nerdctl (default: $LAB_RUNTIME or auto-detect)\n")
+	fmt.Fprintf(w, "\n%s\n", bold("Examples:"))
+	fmt.Fprintf(w, "  ./lab init                     # Initialize with 2 containers\n")
+	fmt.Fprintf(w, "  ./lab init --containers 5      # Initialize with 5 containers\n")
+	fmt.Fprintf(w, "  ./lab init -c 3                # Initialize with 3 containers\n")
+	fmt.Fprintf(w, "  ./lab init -f labs/web.yaml    # Initialize from a lab spec file\n")
+	fmt.Fprintf(w, "  ./lab start                    # Start existing lab environment\n")
+	fmt.Fprintf(w, "  ./lab init --lab db -c 2       # Run a second lab named db alongside\n")
+	fmt.Fprintf(w, "  ./lab init -c 4 --group web=1-3 --group db=4  # Initialize with inventory groups\n")
+	fmt.Fprintf(w, "  ./lab ssh lab-02 --user root   # Root shell on lab-02\n")
+	fmt.Fprintf(w, "  ./lab ssh-config               # Then Include ~/.lab/lab/ssh_config and ssh lab-01\n")
+	fmt.Fprintf(w, "  ./lab exec -- uptime           # Run uptime on every node\n")
+	fmt.Fprintf(w, "  ./lab cp ./configs lab-01:/etc/app  # Push a directory to lab-01\n")
+	fmt.Fprintf(w, "  ./lab logs --follow --service nginx  # Follow entrypoint and nginx logs\n")
+	fmt.Fprintln(w)
+}
 
-	if containerCount <= 0 {
-		containerCount = 2
-	}
+// errNoContainers is returned by commands that need a running lab
+var errNoContainers = errors.New("no lab containers running - run ./lab start to start the lab first")
+
+// exitCodeError ends the tool with Code without a message, for commands that
+// pass on the exit status of remote commands
+type exitCodeError struct {
+	Code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (a *App) initLab(ctx context.Context, spec *LabSpec) error {
+	fmt.Fprintf(a.Out, "\n%s %s\n", green("🚀"), bold("Initializing LAB environment..."))
+	fmt.Fprintf(a.Out, "%s\n", blue("═════════════════════════════════════"))
 
 	// Check if containers are already running
-	containers := getContainers()
+	containers, err := a.getContainers(ctx, spec)
+	if err != nil {
+		return err
+	}
 	if len(containers) > 0 {
-		fmt.Printf("%s Lab containers are already running\n", yellow("⚠️"))
-		fmt.Printf("Use %s to stop first, then %s to reinitialize\n", yellow("./lab stop"), green("./lab init"))
-		return
+		return fmt.Errorf("lab %q is already running - use ./lab stop first, then ./lab init to reinitialize", spec.Name)
+	}
+
+	fmt.Fprintf(a.Out, "%s Lab: %s\n", cyan("🏷️"), bold(spec.Name))
+	if spec.source != "" {
+		fmt.Fprintf(a.Out, "%s Using lab spec %s\n", cyan("📄"), bold(spec.source))
+	}
+	fmt.Fprintf(a.Out, "%s Creating %d containers...\n", cyan("📊"), len(spec.Nodes))
+	if len(spec.Groups) > 0 {
+		var groups []string
+		for _, name := range spec.groupNames() {
+			groups = append(groups, fmt.Sprintf("%s (%d)", name, len(spec.groupMembers(name))))
+		}
+		fmt.Fprintf(a.Out, "%s Groups: %s\n", cyan("👥"), strings.Join(groups, ", "))
 	}
 
-	// Check if docker-compose.yml exists and warn but allow override
-	if _, err := os.Stat("docker-compose.yml"); err == nil {
-		fmt.Printf("%s docker-compose.yml exists - will be overwritten\n", yellow("⚠️"))
+	// Start the lab, replacing any stopped containers left from a previous init
+	fmt.Fprintf(a.Out, "%s Building and starting containers...\n", cyan("📦"))
+	if err := a.createLab(ctx, spec, true); err != nil {
+		return fmt.Errorf("failed to start lab: %w", err)
 	}
 
-	fmt.Printf("%s Creating %d containers...\n", cyan("📊"), containerCount)
+	fmt.Fprintf(a.Out, "%s Lab initialized and started successfully!\n", green("✅"))
 
-	// Generate dynamic docker-compose.yml
-	err := generateDockerCompose(containerCount)
-	if err != nil {
-		fmt.Printf("%s Failed to generate docker-compose.yml: %v\n", red("❌"), err)
-		return
+	if err := a.waitForLab(ctx, spec); err != nil {
+		return err
 	}
 
-	// Start the lab
-	fmt.Printf("%s Building and starting containers...\n", cyan("📦"))
-	cmd := exec.Command("docker", "compose", "up", "-d")
-	output, err := cmd.CombinedOutput()
+	// Show connection details
+	return a.showConnectionDetails(ctx, spec)
+}
 
-	if err != nil {
-		fmt.Printf("%s Failed to start lab: %v\n", red("❌"), err)
-		fmt.Printf("Output: %s\n", string(output))
-		return
+func (a *App) startLab(ctx context.Context, spec *LabSpec) error {
+	fmt.Fprintf(a.Out, "\n%s %s\n", green("🚀"), bold("Starting LAB environment..."))
+	fmt.Fprintf(a.Out, "%s\n", blue("═══════════════════════════════════"))
+
+	fmt.Fprintf(a.Out, "%s Starting containers...\n", cyan("📦"))
+	if spec.source != "" {
+		// A lab spec is the source of truth, so create any nodes that are missing
+		fmt.Fprintf(a.Out, "%s Using lab spec %s\n", cyan("📄"), bold(spec.source))
+		if err := a.createLab(ctx, spec, false); err != nil {
+			return fmt.Errorf("failed to start lab: %w", err)
+		}
+	} else {
+		containers, err := a.Runtime.ListContainers(ctx, ListOptions{All: true, Labels: roleLabels(spec, roleNode)})
+		if err != nil {
+			return fmt.Errorf("failed to start lab: %w", err)
+		}
+		if len(containers) == 0 {
+			return fmt.Errorf("no containers found for lab %q - run ./lab init first to initialize the lab environment", spec.Name)
+		}
+		for _, container := range containers {
+			if err := a.Runtime.StartContainer(ctx, container.ID); err != nil {
+				return fmt.Errorf("failed to start %s: %w", container.Name, err)
+			}
+		}
 	}
 
-	fmt.Printf("%s Lab initialized and started successfully!\n", green("✅"))
+	fmt.Fprintf(a.Out, "%s Lab started successfully!\n", green("✅"))
 
-	// Wait a moment for containers to initialize
-	time.Sleep(2 * time.Second)
+	if err := a.waitForLab(ctx, spec); err != nil {
+		return err
+	}
 
 	// Show connection details
-	showConnectionDetails()
+	return a.showConnectionDetails(ctx, spec)
 }
 
-func startLab() {
-	fmt.Printf("\n%s %s\n", green("🚀"), bold("Starting LAB environment..."))
-	fmt.Printf("%s\n", blue("═══════════════════════════════════"))
-
-	// Check if docker-compose.yml exists
-	if _, err := os.Stat("docker-compose.yml"); os.IsNotExist(err) {
-		fmt.Printf("%s No docker-compose.yml found\n", red("❌"))
-		fmt.Printf("Run %s first to initialize the lab environment\n", green("./lab init"))
-		return
+// createLab creates the image, networks, volumes and containers described by
+// spec and starts every node. With recreate set, existing containers are
+// replaced; otherwise only missing nodes are created.
+func (a *App) createLab(ctx context.Context, spec *LabSpec, recreate bool) error {
+	if err := a.ensureImages(ctx, spec); err != nil {
+		return err
+	}
+	if err := a.ensureLabKey(spec); err != nil {
+		return err
+	}
+	if err := a.allocatePorts(ctx, spec); err != nil {
+		return err
 	}
 
-	// Start the lab using existing docker-compose.yml
-	fmt.Printf("%s Starting containers...\n", cyan("📦"))
-	cmd := exec.Command("docker", "compose", "up", "-d")
-	output, err := cmd.CombinedOutput()
+	networks, err := a.Runtime.ListNetworks(ctx, ListOptions{Labels: roleLabels(spec, roleNetwork)})
+	if err != nil {
+		return err
+	}
+	existingNetworks := map[string]bool{}
+	for _, network := range networks {
+		existingNetworks[network.Name] = true
+	}
+	for _, network := range spec.Networks {
+		name := spec.networkName(network.Name)
+		if existingNetworks[name] {
+			continue
+		}
+		if err := a.Runtime.CreateNetwork(ctx, name, network.Subnet, ownerLabels(spec, roleNetwork, "")); err != nil {
+			return fmt.Errorf("failed to create network %s: %w", name, err)
+		}
+	}
 
+	containers, err := a.Runtime.ListContainers(ctx, ListOptions{All: true, Labels: roleLabels(spec, roleNode)})
 	if err != nil {
-		fmt.Printf("%s Failed to start lab: %v\n", red("❌"), err)
-		fmt.Printf("Output: %s\n", string(output))
-		return
+		return err
+	}
+	existing := map[string]Container{}
+	for _, container := range containers {
+		existing[container.Name] = container
 	}
+	created := map[string]string{}
 
-	fmt.Printf("%s Lab started successfully!\n", green("✅"))
+	for _, node := range spec.Nodes {
+		if container, found := existing[spec.containerName(node)]; found {
+			if !recreate {
+				if err := a.Runtime.StartContainer(ctx, container.ID); err != nil {
+					return fmt.Errorf("failed to start %s: %w", node.Name, err)
+				}
+				continue
+			}
+			if err := a.Runtime.RemoveContainer(ctx, container.ID); err != nil {
+				return fmt.Errorf("failed to remove old container %s: %w", node.Name, err)
+			}
+		}
 
-	// Wait a moment for containers to initialize
-	time.Sleep(2 * time.Second)
+		config := nodeContainerConfig(spec, node)
+		for _, mount := range config.Mounts {
+			if err := a.createVolume(ctx, spec, node, mount.Volume); err != nil {
+				return err
+			}
+		}
 
-	// Show connection details
-	showConnectionDetails()
+		id, err := a.Runtime.CreateContainer(ctx, config)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", node.Name, err)
+		}
+		if err := a.Runtime.StartContainer(ctx, id); err != nil {
+			return fmt.Errorf("failed to start %s: %w", node.Name, err)
+		}
+		created[node.Name] = id
+	}
+	// The state records the passwords first, so a failure leaves them known
+	if err := a.recordState(ctx, spec); err != nil {
+		return err
+	}
+	return a.setPasswords(ctx, spec, created)
 }
 
-func stopLab() {
-	fmt.Printf("\n%s %s\n", yellow("🛑"), bold("Stopping LAB environment..."))
-	fmt.Printf("%s\n", blue("═══════════════════════════════════"))
-
-	cmd := exec.Command("docker", "compose", "down")
-	output, err := cmd.CombinedOutput()
-
+// createVolume creates a node volume, reusing it when it already belongs to the
+// lab. A volume of the same name without the lab's labels is left alone.
+func (a *App) createVolume(ctx context.Context, spec *LabSpec, node NodeSpec, name string) error {
+	volumes, err := a.Runtime.ListVolumes(ctx, ListOptions{Name: name})
 	if err != nil {
-		fmt.Printf("%s Failed to stop lab: %v\n", red("❌"), err)
-		fmt.Printf("Output: %s\n", string(output))
-		return
+		return err
+	}
+	for _, volume := range volumes {
+		if volume.Name != name {
+			continue
+		}
+		if volume.Labels[labNameLabel] != spec.Name {
+			return fmt.Errorf("volume %s already exists and does not belong to lab %q - remove or rename it", name, spec.Name)
+		}
+		return nil
 	}
 
-	fmt.Printf("%s Lab stopped successfully!\n", green("✅"))
+	if err := a.Runtime.CreateVolume(ctx, name, ownerLabels(spec, roleVolume, node.Name)); err != nil {
+		return fmt.Errorf("failed to create volume %s: %w", name, err)
+	}
+	return nil
 }
 
-func cleanLab() {
-	fmt.Printf("\n%s %s\n", red("🧹"), bold("Cleaning LAB environment..."))
-	fmt.Printf("%s\n", blue("══════════════════════════════════"))
-
-	// Stop containers and remove volumes
-	fmt.Printf("%s Stopping containers and removing volumes...\n", yellow("🛑"))
-	stopCmd := exec.Command("docker", "compose", "down", "-v", "--remove-orphans")
-	stopCmd.Run()
-
-	// Remove lab-specific volumes
-	fmt.Printf("%s Removing lab volumes...\n", red("💾"))
-	volumesCmd := exec.Command("docker", "volume", "ls", "-q", "--filter", "name=lab-")
-	volumeOutput, err := volumesCmd.Output()
-	if err == nil && len(strings.TrimSpace(string(volumeOutput))) > 0 {
-		volumes := strings.Split(strings.TrimSpace(string(volumeOutput)), "\n")
-		for _, volume := range volumes {
-			if strings.TrimSpace(volume) != "" {
-				removeVolCmd := exec.Command("docker", "volume", "rm", strings.TrimSpace(volume))
-				removeVolCmd.Run()
+// ensureImages builds or pulls the images used by the lab when they are not
+// present locally. The built image is labelled with the hash of its build
+// context and rebuilt when the context no longer matches.
+func (a *App) ensureImages(ctx context.Context, spec *LabSpec) error {
+	images := []string{spec.Image.Name}
+	for _, node := range spec.Nodes {
+		if node.Image != "" {
+			images = append(images, node.Image)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, image := range images {
+		if seen[image] {
+			continue
+		}
+		seen[image] = true
+
+		exists, err := a.Runtime.ImageExists(ctx, image)
+		if err != nil {
+			return err
+		}
+
+		if image == spec.Image.Name && spec.Image.Build != "" {
+			// An image built from another Dockerfile or entrypoint.sh, for
+			// example by an older version of the tool, is rebuilt
+			buildHash, err := buildContextHash(spec.buildContext())
+			if err != nil {
+				return err
+			}
+			if exists {
+				labels, err := a.Runtime.ImageLabels(ctx, image)
+				if err != nil {
+					return err
+				}
+				if labels[labBuildHashLabel] == buildHash {
+					continue
+				}
+				fmt.Fprintf(a.Out, "%s Rebuilding image %s - its build context changed\n", cyan("🔨"), image)
+			} else {
+				fmt.Fprintf(a.Out, "%s Building image %s...\n", cyan("🔨"), image)
+			}
+			if err := a.Runtime.BuildImage(ctx, spec.buildContext(), image, imageLabels(buildHash)); err != nil {
+				return fmt.Errorf("failed to build %s: %w", image, err)
+			}
+		} else if !exists {
+			fmt.Fprintf(a.Out, "%s Pulling image %s...\n", cyan("📥"), image)
+			if err := a.Runtime.PullImage(ctx, image); err != nil {
+				return fmt.Errorf("failed to pull %s: %w", image, err)
 			}
 		}
 	}
+	return nil
+}
 
-	// Remove lab network
-	fmt.Printf("%s Removing lab network...\n", red("🌐"))
-	networkCmd := exec.Command("docker", "network", "rm", "lab-network")
-	networkCmd.Run()
+// allocatePorts picks the SSH host port of every node. A node keeps the port
+// of its existing container or the one recorded in the lab state, then tries
+// its preferred port, and otherwise takes the first free port of the SSH range.
+// Ports used by other labs or bound on the host are skipped; ports pinned in
+// the spec are never moved, so a clash on one is an error.
+func (a *App) allocatePorts(ctx context.Context, spec *LabSpec) error {
+	first, last, err := parsePortRange(spec.Ports.SSHRange)
+	if err != nil {
+		return fmt.Errorf("ports.ssh_range: %w", err)
+	}
 
-	// Remove lab images
-	fmt.Printf("%s Removing lab images...\n", red("🗑️"))
-	imagesCmd := exec.Command("docker", "images", "-q", "lab/image")
-	imageOutput, err := imagesCmd.Output()
-	if err == nil && len(strings.TrimSpace(string(imageOutput))) > 0 {
-		removeCmd := exec.Command("docker", "rmi", "lab/image:latest")
-		removeCmd.Run()
+	containers, err := a.Runtime.ListContainers(ctx, ListOptions{All: true, Labels: allNodeLabels()})
+	if err != nil {
+		return err
+	}
+	used := map[int]string{}     // host port -> lab using it
+	existing := map[string]int{} // node -> SSH port of its container in this lab
+	for _, container := range containers {
+		lab := container.Labels[labNameLabel]
+		if lab == spec.Name {
+			if port := container.SSHPort(); port != 0 {
+				existing[spec.nodeName(container)] = port
+			}
+			continue
+		}
+		for _, binding := range container.Ports {
+			used[binding.HostPort] = lab
+		}
+		if state, err := a.loadState(lab); err == nil {
+			for _, port := range state.ports() {
+				used[port] = lab
+			}
+		}
 	}
 
-	// Note: docker-compose.yml is preserved to maintain user customizations
+	claimed := map[int]bool{}
+	portFree := a.PortFree
+	if portFree == nil {
+		portFree = hostPortFree
+	}
+	free := func(port int) bool {
+		return !claimed[port] && used[port] == "" && portFree(port)
+	}
 
-	// Clean up unused Docker resources
-	fmt.Printf("%s Cleaning unused Docker resources...\n", cyan("🧽"))
-	pruneCmd := exec.Command("docker", "system", "prune", "-f")
-	pruneCmd.Run()
+	// Extra port mappings and pinned SSH ports cannot move
+	for i, node := range spec.Nodes {
+		for _, mapping := range node.Ports {
+			binding, _ := parsePortMapping(mapping)
+			if lab := used[binding.HostPort]; lab != "" {
+				return fmt.Errorf("host port %d of node %s is already used by lab %q", binding.HostPort, node.Name, lab)
+			}
+			claimed[binding.HostPort] = true
+		}
+		if node.pinnedPort {
+			if lab := used[node.SSHPort]; lab != "" {
+				return fmt.Errorf("host port %d is already used by lab %q - change nodes[%d].ssh_port in %s", node.SSHPort, lab, i, spec.source)
+			}
+			if existing[node.Name] != node.SSHPort && !portFree(node.SSHPort) {
+				return fmt.Errorf("host port %d of node %s is already in use on this host", node.SSHPort, node.Name)
+			}
+			claimed[node.SSHPort] = true
+		}
+	}
 
-	fmt.Printf("%s Lab environment cleaned completely!\n", green("✅"))
-	fmt.Printf("%s docker-compose.yml preserved - use %s to start again\n", cyan("💡"), green("./lab start"))
-}
+	ports := map[string]int{}
+	for _, node := range spec.Nodes {
+		if node.pinnedPort {
+			ports[node.Name] = node.SSHPort
+			continue
+		}
+		if port := existing[node.Name]; port != 0 && !claimed[port] {
+			ports[node.Name] = port
+			claimed[port] = true
+			continue
+		}
+		for _, port := range []int{spec.ports[node.Name], node.SSHPort} {
+			if port != 0 && free(port) {
+				ports[node.Name] = port
+				break
+			}
+		}
+		for port := first; ports[node.Name] == 0 && port <= last; port++ {
+			if free(port) {
+				ports[node.Name] = port
+			}
+		}
+		if ports[node.Name] == 0 {
+			return fmt.Errorf("no free SSH port left in %d-%d for node %s - use a wider --port-range", first, last, node.Name)
+		}
+		claimed[ports[node.Name]] = true
+	}
 
-func showStatus() {
-	fmt.Printf("\n%s %s\n", blue("📊"), bold("LAB Status"))
-	fmt.Printf("%s\n", blue("═══════════════════"))
+	spec.ports = ports
+	return nil
+}
 
-	// Check containers
-	containers := getContainers()
-	if len(containers) == 0 {
-		fmt.Printf("%s No lab containers running\n", yellow("⚠️"))
-		fmt.Printf("\nRun %s to start the lab\n", green("./lab start"))
-		return
+// hostPortFree reports whether a TCP port can be bound on the host
+func hostPortFree(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
 	}
+	listener.Close()
+	return true
+}
 
-	// Display container status
-	displayContainerTable(containers)
+// nodeContainerConfig describes the container for a lab node
+func nodeContainerConfig(spec *LabSpec, node NodeSpec) ContainerConfig {
+	image := node.Image
+	if image == "" {
+		image = spec.Image.Name
+	}
 
-	// Show connection details
-	showConnectionDetails()
+	name := spec.containerName(node)
+	config := ContainerConfig{
+		Name:     name,
+		Hostname: node.Name,
+		Image:    image,
+		Env: []string{
+			"USER=" + spec.User.Name,
+			fmt.Sprintf("SUDO=%t", *spec.User.Sudo),
+			fmt.Sprintf("PASSWORD_AUTH=%t", *spec.User.PasswordAuth),
+		},
+		Labels:        ownerLabels(spec, roleNode, node.Name),
+		Ports:         []PortBinding{{HostPort: spec.sshPort(node), ContainerPort: 22, Protocol: "tcp"}},
+		RestartPolicy: "unless-stopped",
+	}
+	for _, network := range node.Networks {
+		config.Networks = append(config.Networks, spec.networkName(network))
+	}
+	if spec.authorizedKey != "" {
+		config.Env = append(config.Env, "AUTHORIZED_KEY="+spec.authorizedKey)
+	}
+	for _, key := range sortedKeys(node.Env) {
+		config.Env = append(config.Env, key+"="+node.Env[key])
+	}
+	for _, mapping := range node.Ports {
+		// Mappings were validated with the spec
+		binding, _ := parsePortMapping(mapping)
+		config.Ports = append(config.Ports, binding)
+	}
+	for _, volume := range spec.Volumes {
+		config.Mounts = append(config.Mounts, Mount{Volume: name + "-" + volume.Name, Target: volume.Path})
+	}
+	return config
 }
 
-func getContainers() []Container {
-	cmd := exec.Command("docker", "ps", "--filter", "name=lab-", "--format", "{{.Names}}:{{.Status}}:{{.Ports}}")
-	output, err := cmd.Output()
+func (a *App) stopLab(ctx context.Context, spec *LabSpec) error {
+	fmt.Fprintf(a.Out, "\n%s %s\n", yellow("🛑"), bold("Stopping LAB environment..."))
+	fmt.Fprintf(a.Out, "%s\n", blue("═══════════════════════════════════"))
 
+	containers, err := a.getContainers(ctx, spec)
 	if err != nil {
-		return []Container{}
+		return err
 	}
+	for _, container := range containers {
+		if err := a.Runtime.StopContainer(ctx, container.ID, 10*time.Second); err != nil {
+			return fmt.Errorf("failed to stop lab: %w", err)
+		}
+	}
+
+	fmt.Fprintf(a.Out, "%s Lab stopped successfully!\n", green("✅"))
+	return nil
+}
 
-	lines := strings.Split(string(output), "\n")
-	containers := []Container{}
+// showStatus shows the lab's containers, or those picked by node patterns and a
+// spec group, and how to connect to them
+func (a *App) showStatus(ctx context.Context, spec *LabSpec, nodes, group string) error {
+	fmt.Fprintf(a.Out, "\n%s %s\n", blue("📊"), bold("LAB Status"))
+	fmt.Fprintf(a.Out, "%s\n", blue("═══════════════════"))
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue // Skip empty lines
+	// Check containers
+	containers, err := a.getContainers(ctx, spec)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		fmt.Fprintf(a.Out, "%s No containers running for lab %s\n", yellow("⚠️"), bold(spec.Name))
+		fmt.Fprintf(a.Out, "\nRun %s to start the lab\n", green("./lab start"))
+		return nil
+	}
+	if nodes != "" || group != "" {
+		if containers, err = filterNodes(spec, containers, nodes, group); err != nil {
+			return err
 		}
+	}
 
-		parts := strings.Split(line, ":")
-		if len(parts) >= 3 {
-			// Rejoin ports part (it may contain colons)
-			ports := strings.Join(parts[2:], ":")
-			container := Container{
-				Name:   strings.TrimSpace(parts[0]),
-				Status: strings.TrimSpace(parts[1]),
-				Ports:  strings.TrimSpace(ports),
+	// Display container status
+	a.displayContainerTable(spec, containers)
+
+	// Containers remember the spec they were created from
+	if spec.source != "" {
+		hash := specHash(spec)
+		for _, container := range containers {
+			if container.Labels[labSpecHashLabel] != hash {
+				fmt.Fprintf(a.Out, "%s %s changed since %s was created - run %s to apply it\n",
+					yellow("⚠️"), spec.source, container.Name, green("./lab stop && ./lab init"))
+				break
 			}
-			containers = append(containers, container)
 		}
 	}
 
-	return containers
+	// Show connection details
+	return a.printConnectionDetails(spec, containers)
 }
 
-type Container struct {
-	Name   string
-	Status string
-	Ports  string
+// getContainers returns the running containers of the spec's lab sorted by name
+func (a *App) getContainers(ctx context.Context, spec *LabSpec) ([]Container, error) {
+	containers, err := a.Runtime.ListContainers(ctx, ListOptions{Labels: roleLabels(spec, roleNode)})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Name < containers[j].Name
+	})
+	return containers, nil
 }
 
-func displayContainerTable(containers []Container) {
-	table := tablewriter.NewWriter(os.Stdout)
+func (a *App) displayContainerTable(spec *LabSpec, containers []Container) {
+	table := tablewriter.NewWriter(a.Out)
 	table.SetHeader([]string{"Container", "Status", "SSH Port", "Hostname"})
 	table.SetBorder(true)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 
 	for _, container := range containers {
-		status := container.Status
-		if strings.Contains(status, "Up") {
+		status := red("Stopped")
+		if container.Running() {
 			status = green("Running")
-		} else {
-			status = red("Stopped")
 		}
 
-		// Extract SSH port
-		sshPort := extractSSHPort(container.Ports)
-		hostname := extractHostname(container.Name)
+		sshPort := "N/A"
+		if port := spec.containerSSHPort(container); port != 0 {
+			sshPort = strconv.Itoa(port)
+		}
+		hostname := spec.nodeName(container)
 
 		table.Append([]string{
 			container.Name,
@@ -318,304 +1026,139 @@ func displayContainerTable(containers []Container) {
 	table.Render()
 }
 
-func extractSSHPort(ports string) string {
-	re := regexp.MustCompile(`0\.0\.0\.0:(\d+)->22/tcp`)
-	matches := re.FindStringSubmatch(ports)
-	if len(matches) > 1 {
-		return matches[1]
-	}
-	return "N/A"
-}
-
-func extractHostname(containerName string) string {
-	// Extract lab-XX from container name
-	re := regexp.MustCompile(`lab-(\d+)`)
-	matches := re.FindStringSubmatch(containerName)
-	if len(matches) > 1 {
-		return "lab-" + matches[1]
+func (a *App) showConnectionDetails(ctx context.Context, spec *LabSpec) error {
+	containers, err := a.getContainers(ctx, spec)
+	if err != nil {
+		return err
 	}
-	return "unknown"
+	return a.printConnectionDetails(spec, containers)
 }
 
-func showConnectionDetails() {
-	fmt.Printf("\n%s %s\n", cyan("🔗"), bold("Connection Details"))
-	fmt.Printf("%s\n", blue("═══════════════════════"))
-
-	containers := getContainers()
+// printConnectionDetails shows how to reach the given containers
+func (a *App) printConnectionDetails(spec *LabSpec, containers []Container) error {
+	fmt.Fprintf(a.Out, "\n%s %s\n", cyan("🔗"), bold("Connection Details"))
+	fmt.Fprintf(a.Out, "%s\n", blue("═══════════════════════"))
 	if len(containers) == 0 {
-		return
+		return nil
 	}
 
-	fmt.Printf("\n%s\n", bold("SSH Connections:"))
+	fmt.Fprintf(a.Out, "\n%s\n", bold("SSH Connections:"))
 
 	for _, container := range containers {
-		if strings.Contains(container.Status, "Up") {
-			sshPort := extractSSHPort(container.Ports)
-			hostname := extractHostname(container.Name)
-
-			if sshPort != "N/A" {
-				fmt.Printf("  %s %s:\n", green("→"), bold(hostname))
-				fmt.Printf("    %s ssh labuser@localhost -p %s\n", cyan("$"), sshPort)
-				fmt.Printf("    %s labpass123\n", yellow("Password:"))
-				fmt.Println()
+		if container.Running() {
+			sshPort := spec.containerSSHPort(container)
+			hostname := spec.nodeName(container)
+
+			if sshPort != 0 {
+				fmt.Fprintf(a.Out, "  %s %s:\n", green("→"), bold(hostname))
+				fmt.Fprintf(a.Out, "    %s ./lab ssh %s\n", cyan("$"), hostname)
+				if spec.keyFile != "" {
+					fmt.Fprintf(a.Out, "    %s ssh -i %s %s@localhost -p %d\n", cyan("$"), spec.keyFile, spec.User.Name, sshPort)
+				} else {
+					fmt.Fprintf(a.Out, "    %s ssh %s@localhost -p %d\n", cyan("$"), spec.User.Name, sshPort)
+				}
+				if *spec.User.PasswordAuth {
+					fmt.Fprintf(a.Out, "    %s %s\n", yellow("Password:"), a.secret(spec.User.Password))
+				}
+				fmt.Fprintln(a.Out)
 			}
 		}
 	}
 
-	fmt.Printf("%s\n", bold("Environment Variables:"))
-	fmt.Printf("  %s ROOT_PASSWORD: %s\n", blue("•"), yellow("labroot123"))
-	fmt.Printf("  %s USER: %s\n", blue("•"), yellow("labuser"))
-	fmt.Printf("  %s USER_PASSWORD: %s\n", blue("•"), yellow("labpass123"))
-	fmt.Printf("  %s SUDO: %s\n", blue("•"), yellow("true"))
-	fmt.Println()
-}
-
-func generateInventory() {
-	fmt.Printf("\n%s %s\n", cyan("📋"), bold("Generating Ansible Inventory"))
-	fmt.Printf("%s\n", blue("═══════════════════════════════════"))
-
-	// Check if containers are running
-	containers := getContainers()
-	if len(containers) == 0 {
-		fmt.Printf("%s No lab containers running\n", yellow("⚠️"))
-		fmt.Printf("Run %s to start the lab first\n", green("./lab start"))
-		return
+	fmt.Fprintf(a.Out, "%s\n", bold("Accounts:"))
+	fmt.Fprintf(a.Out, "  %s Root password: %s\n", blue("•"), yellow(a.secret(spec.User.RootPassword)))
+	fmt.Fprintf(a.Out, "  %s User: %s\n", blue("•"), yellow(spec.User.Name))
+	fmt.Fprintf(a.Out, "  %s User password: %s\n", blue("•"), yellow(a.secret(spec.User.Password)))
+	fmt.Fprintf(a.Out, "  %s Sudo: %s\n", blue("•"), yellow(*spec.User.Sudo))
+	if !a.ShowSecrets {
+		fmt.Fprintf(a.Out, "  %s Passwords are hidden - use --show-secrets or ./lab credentials\n", cyan("💡"))
 	}
-
-	// Generate dynamic inventory based on running containers
-	inventoryContent := generateInventoryContent(containers)
-
-	// Write to file
-	err := os.WriteFile("inventory.yml", []byte(inventoryContent), 0644)
-	if err != nil {
-		fmt.Printf("%s Failed to write inventory file: %v\n", red("❌"), err)
-		return
-	}
-
-	fmt.Printf("%s Ansible inventory generated: %s\n", green("✅"), bold("inventory.yml"))
-	fmt.Printf("\n%s\n", bold("Usage with Ansible:"))
-	fmt.Printf("  %s ansible -i inventory.yml lab_nodes -m ping\n", cyan("$"))
-	fmt.Printf("  %s ansible-playbook -i inventory.yml playbook.yml\n", cyan("$"))
-	fmt.Println()
+	fmt.Fprintln(a.Out)
+	return nil
 }
 
-func generateInventoryContent(containers []Container) string {
-	content := `---
-# LAB Ansible Inventory (Generated)
-# This inventory file contains all running lab containers
-# Use this with Ansible to manage lab containers via SSH
-
-all:
-  children:
-    lab_environment:
-      children:
-        lab_nodes:
-          hosts:
-`
-
-	// Add each running container to inventory
-	for _, container := range containers {
-		if strings.Contains(container.Status, "Up") {
-			sshPort := extractSSHPort(container.Ports)
-			hostname := extractHostname(container.Name)
-
-			if sshPort != "N/A" {
-				content += fmt.Sprintf(`            %s:
-              ansible_host: localhost
-              ansible_port: %s
-              ansible_user: labuser
-              ansible_ssh_pass: labpass123
-              ansible_ssh_common_args: '-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null'
-              container_name: %s
-              hostname: %s
-              ssh_port: %s
-              
-`, hostname, sshPort, container.Name, hostname, sshPort)
-			}
-		}
+// yamlString quotes a value unless it is already read back as a plain YAML string
+func yamlString(value string) string {
+	if plainYAMLPattern.MatchString(value) && !yamlKeywords[strings.ToLower(value)] {
+		return value
 	}
-
-	content += `          vars:
-            # Common variables for all lab nodes
-            ansible_python_interpreter: /usr/bin/python3
-            lab_root_password: labroot123
-            lab_user_password: labpass123
-            lab_sudo_enabled: true
-            lab_environment: lab
-            
-    # Group variables for specific roles
-    ubuntu_nodes:
-      children:
-        lab_nodes:
-      vars:
-        ansible_os_family: Debian
-        ansible_distribution: Ubuntu
-        ansible_distribution_version: "22.04"
-`
-
-	return content
+	return strconv.Quote(value)
 }
 
-func testConnectivity() {
-	fmt.Printf("\n%s %s\n", blue("🧪"), bold("Testing LAB Connectivity"))
-	fmt.Printf("%s\n", blue("═══════════════════════════════════"))
+// listLabs shows every lab found in the runtime with its node and SSH port summary
+func (a *App) listLabs(ctx context.Context) error {
+	fmt.Fprintf(a.Out, "\n%s %s\n", blue("📚"), bold("Labs"))
+	fmt.Fprintf(a.Out, "%s\n", blue("═══════════════════"))
 
-	// Check if containers are running
-	containers := getContainers()
+	containers, err := a.Runtime.ListContainers(ctx, ListOptions{All: true, Labels: allNodeLabels()})
+	if err != nil {
+		return err
+	}
 	if len(containers) == 0 {
-		fmt.Printf("%s No lab containers running\n", yellow("⚠️"))
-		fmt.Printf("Run %s to start the lab first\n", green("./lab start"))
-		return
+		fmt.Fprintf(a.Out, "%s No labs found\n", yellow("⚠️"))
+		fmt.Fprintf(a.Out, "\nRun %s to create one\n", green("./lab init --lab NAME"))
+		return nil
 	}
 
-	fmt.Printf("\n%s\n", bold("SSH Connectivity Tests:"))
-
-	allPassed := true
+	labs := map[string][]Container{}
 	for _, container := range containers {
-		if strings.Contains(container.Status, "Up") {
-			sshPort := extractSSHPort(container.Ports)
-			hostname := extractHostname(container.Name)
-
-			if sshPort != "N/A" {
-				fmt.Printf("  %s Testing %s (port %s)... ", blue("→"), bold(hostname), sshPort)
-
-				// Test SSH connection with cross-platform timeout
-				var cmd *exec.Cmd
-
-				// Try different timeout commands based on platform
-				if _, err := exec.LookPath("timeout"); err == nil {
-					// Linux timeout command
-					cmd = exec.Command("timeout", "10", "sshpass", "-p", "labpass123", "ssh",
-						"-o", "StrictHostKeyChecking=no",
-						"-o", "UserKnownHostsFile=/dev/null",
-						"-o", "ConnectTimeout=5",
-						"-p", sshPort, "labuser@localhost", "echo 'SSH_OK'")
-				} else if _, err := exec.LookPath("gtimeout"); err == nil {
-					// macOS gtimeout command (from coreutils)
-					cmd = exec.Command("gtimeout", "10", "sshpass", "-p", "labpass123", "ssh",
-						"-o", "StrictHostKeyChecking=no",
-						"-o", "UserKnownHostsFile=/dev/null",
-						"-o", "ConnectTimeout=5",
-						"-p", sshPort, "labuser@localhost", "echo 'SSH_OK'")
-				} else {
-					// Fallback without external timeout (relies on SSH ConnectTimeout)
-					cmd = exec.Command("sshpass", "-p", "labpass123", "ssh",
-						"-o", "StrictHostKeyChecking=no",
-						"-o", "UserKnownHostsFile=/dev/null",
-						"-o", "ConnectTimeout=5",
-						"-p", sshPort, "labuser@localhost", "echo 'SSH_OK'")
-				}
-
-				output, err := cmd.Output()
-				if err != nil || !strings.Contains(string(output), "SSH_OK") {
-					fmt.Printf("%s\n", red("FAILED"))
-					allPassed = false
-				} else {
-					fmt.Printf("%s\n", green("PASSED"))
-				}
-			}
-		}
+		lab := container.Labels[labNameLabel]
+		labs[lab] = append(labs[lab], container)
 	}
+	table := tablewriter.NewWriter(a.Out)
+	table.SetHeader([]string{"Lab", "State", "Nodes", "SSH Ports"})
+	table.SetBorder(true)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
 
-	// Test Ansible if available
-	fmt.Printf("\n%s\n", bold("Ansible Connectivity Tests:"))
-
-	// Check if ansible is installed
-	_, err := exec.LookPath("ansible")
-	if err != nil {
-		fmt.Printf("  %s Ansible not installed - skipping Ansible tests\n", yellow("⚠️"))
-		fmt.Printf("  %s Install with: sudo apt install ansible\n", cyan("💡"))
-	} else {
-		// Generate inventory for testing
-		inventoryContent := generateInventoryContent(containers)
-		err := os.WriteFile("inventory-test.yml", []byte(inventoryContent), 0644)
+	for _, name := range sortedKeys(labs) {
+		labState, err := a.loadState(name)
 		if err != nil {
-			fmt.Printf("  %s Failed to create test inventory\n", red("❌"))
-		} else {
-			fmt.Printf("  %s Testing Ansible ping... ", blue("→"))
-
-			cmd := exec.Command("ansible", "-i", "inventory-test.yml", "lab_nodes", "-m", "ping")
-			output, err := cmd.CombinedOutput()
+			return err
+		}
+		labSpec := &LabSpec{Name: name, ports: labState.ports()}
 
-			if err != nil {
-				fmt.Printf("%s\n", red("FAILED"))
-				fmt.Printf("    %s\n", string(output))
-				allPassed = false
-			} else if strings.Contains(string(output), "SUCCESS") {
-				fmt.Printf("%s\n", green("PASSED"))
-			} else {
-				fmt.Printf("%s\n", yellow("PARTIAL"))
-				allPassed = false
+		running := 0
+		ports := []int{}
+		for _, container := range labs[name] {
+			if container.Running() {
+				running++
 			}
+			if port := labSpec.containerSSHPort(container); port != 0 {
+				ports = append(ports, port)
+			}
+		}
 
-			// Clean up test inventory
-			os.Remove("inventory-test.yml")
+		state := yellow(fmt.Sprintf("Partial (%d/%d)", running, len(labs[name])))
+		switch running {
+		case 0:
+			state = red("Stopped")
+		case len(labs[name]):
+			state = green("Running")
 		}
-	}
 
-	fmt.Printf("\n%s\n", bold("Test Summary:"))
-	if allPassed {
-		fmt.Printf("  %s All connectivity tests passed!\n", green("✅"))
-	} else {
-		fmt.Printf("  %s Some tests failed - check SSH configuration\n", red("❌"))
+		portRange := "N/A"
+		if len(ports) > 0 {
+			sort.Ints(ports)
+			portRange = strconv.Itoa(ports[0])
+			if last := ports[len(ports)-1]; last != ports[0] {
+				portRange += "-" + strconv.Itoa(last)
+			}
+		}
+
+		table.Append([]string{name, state, strconv.Itoa(len(labs[name])), portRange})
 	}
-	fmt.Println()
+
+	table.Render()
+	fmt.Fprintln(a.Out)
+	return nil
 }
 
-func generateDockerCompose(containerCount int) error {
-	content := `
-services:`
-
-	// Generate services for each container
-	for i := 1; i <= containerCount; i++ {
-		containerNum := fmt.Sprintf("%02d", i)
-		sshPort := 2221 + i
-
-		content += fmt.Sprintf(`
-  lab-%s:
-    build: .
-    container_name: lab-%s
-    hostname: lab-%s
-    ports:
-      - "%d:22"  # SSH port mapping
-    environment:
-      - ROOT_PASSWORD=labroot123
-      - USER=labuser
-      - USER_PASSWORD=labpass123
-      - SUDO=true
-    volumes:
-      - lab-%s-home:/home  # Persistent user home directories
-      - lab-%s-services:/etc/systemd/system  # Persistent systemd services
-    networks:
-      - lab-network
-    restart: unless-stopped
-`, containerNum, containerNum, containerNum, sshPort, containerNum, containerNum)
-	}
-
-	// Generate volumes section
-	content += `
-volumes:`
-	for i := 1; i <= containerCount; i++ {
-		containerNum := fmt.Sprintf("%02d", i)
-		content += fmt.Sprintf(`
-  lab-%s-home:
-    name: lab-%s-home
-  lab-%s-services:
-    name: lab-%s-services`, containerNum, containerNum, containerNum, containerNum)
-	}
-
-	// Add networks section
-	content += `
-
-networks:
-  lab-network:
-    name: lab-network
-    driver: bridge
-    ipam:
-      config:
-        - subnet: 172.20.0.0/16
-`
-
-	// Write to file
-	return os.WriteFile("docker-compose.yml", []byte(content), 0644)
+// sortedKeys returns map keys in a stable order for generated files
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -1,68 +1,104 @@
 package main
 
 import (
+	"flag"
+	"strings"
 	"testing"
 )
 
-func TestExtractSSHPort(t *testing.T) {
+func TestContainerSSHPort(t *testing.T) {
 	tests := []struct {
-		input    string
-		expected string
+		ports    []PortBinding
+		expected int
 	}{
-		{"0.0.0.0:2222->22/tcp", "2222"},
-		{"0.0.0.0:2223->22/tcp", "2223"},
-		{"0.0.0.0:2224->22/tcp", "2224"},
-		{"invalid", "N/A"},
-		{"", "N/A"},
+		{[]PortBinding{{HostIP: "0.0.0.0", HostPort: 2222, ContainerPort: 22, Protocol: "tcp"}}, 2222},
+		{[]PortBinding{{HostIP: "::", HostPort: 2223, ContainerPort: 22, Protocol: "tcp"}}, 2223},
+		{[]PortBinding{
+			{HostIP: "::", HostPort: 2224, ContainerPort: 22, Protocol: "tcp"},
+			{HostIP: "0.0.0.0", HostPort: 2225, ContainerPort: 22, Protocol: "tcp"},
+		}, 2225},
+		{[]PortBinding{{HostIP: "0.0.0.0", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}, 0},
+		{[]PortBinding{{ContainerPort: 22, Protocol: "tcp"}}, 0},
+		{nil, 0},
 	}
 
 	for _, test := range tests {
-		result := extractSSHPort(test.input)
+		result := Container{Ports: test.ports}.SSHPort()
 		if result != test.expected {
-			t.Errorf("extractSSHPort(%q) = %q, expected %q", test.input, result, test.expected)
+			t.Errorf("SSHPort(%+v) = %d, expected %d", test.ports, result, test.expected)
 		}
 	}
 }
 
-func TestExtractHostname(t *testing.T) {
+func TestSpecNodeName(t *testing.T) {
+	spec := defaultSpec(defaultLabName, 2)
+	webtier := &LabSpec{Name: "webtier", Nodes: []NodeSpec{{Name: "web-01"}, {Name: "webtier-db"}}}
+
 	tests := []struct {
-		input    string
-		expected string
+		spec      *LabSpec
+		container string
+		expected  string
 	}{
-		{"lab-01", "lab-01"},
-		{"lab-02", "lab-02"},
-		{"lab-10", "lab-10"},
-		{"lab-99", "lab-99"},
-		{"invalid", "unknown"},
-		{"", "unknown"},
+		{spec, "lab-01", "lab-01"},
+		{spec, "lab-02", "lab-02"},
+		{spec, "lab-10", "lab-10"},
+		{webtier, "webtier-web-01", "web-01"},
+		{webtier, "webtier-db", "webtier-db"},
+		{webtier, "webtier-cache", "webtier-cache"},
 	}
 
 	for _, test := range tests {
-		result := extractHostname(test.input)
+		result := test.spec.nodeName(Container{Name: test.container})
 		if result != test.expected {
-			t.Errorf("extractHostname(%q) = %q, expected %q", test.input, result, test.expected)
+			t.Errorf("nodeName(%q) in lab %s = %q, expected %q", test.container, test.spec.Name, result, test.expected)
 		}
 	}
+
+	labelled := Container{Name: "webtier-cache", Labels: map[string]string{labNodeLabel: "cache"}}
+	if result := webtier.nodeName(labelled); result != "cache" {
+		t.Errorf("nodeName(%+v) = %q, expected the node label cache", labelled, result)
+	}
 }
 
-func TestGenerateDockerCompose(t *testing.T) {
+func TestNodeContainerConfig(t *testing.T) {
+	spec := defaultSpec(defaultLabName, 2)
+	spec.Nodes[1].Ports = []string{"8080:80"}
+	spec.Nodes[1].Env = map[string]string{"APP_ENV": "staging"}
+
+	config := nodeContainerConfig(spec, spec.Nodes[1])
+	if config.Name != "lab-02" || config.Hostname != "lab-02" || config.Image != defaultImage {
+		t.Errorf("config = %+v, expected lab-02 from %s", config, defaultImage)
+	}
+	if len(config.Ports) != 2 || config.Ports[0].HostPort != 2223 || config.Ports[1].HostPort != 8080 {
+		t.Errorf("ports = %+v, expected 2223->22 and 8080->80", config.Ports)
+	}
+	if len(config.Mounts) != 2 || config.Mounts[0].Volume != "lab-02-home" || config.Mounts[0].Target != "/home" {
+		t.Errorf("mounts = %+v, expected lab-02-home:/home first", config.Mounts)
+	}
+	if config.Env[len(config.Env)-1] != "APP_ENV=staging" {
+		t.Errorf("env = %v, expected node env after the lab env", config.Env)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
 	tests := []struct {
-		containerCount int
-		expectError    bool
+		args       []string
+		positional string
+		user       string
 	}{
-		{2, false},
-		{5, false},
-		{1, false},
-		{10, false},
+		{[]string{"lab-02", "--user", "root"}, "lab-02", "root"},
+		{[]string{"--user", "root", "lab-02"}, "lab-02", "root"},
+		{[]string{"lab-02", "--", "ls", "--user", "x"}, "lab-02 ls --user x", ""},
+		{[]string{"--", "-u"}, "-u", ""},
 	}
 
 	for _, test := range tests {
-		err := generateDockerCompose(test.containerCount)
-		if test.expectError && err == nil {
-			t.Errorf("generateDockerCompose(%d) expected error, got nil", test.containerCount)
-		}
-		if !test.expectError && err != nil {
-			t.Errorf("generateDockerCompose(%d) unexpected error: %v", test.containerCount, err)
+		var user string
+		flagSet := flag.NewFlagSet("ssh", flag.ContinueOnError)
+		flagSet.StringVar(&user, "user", "", "")
+		positional := parseArgs(flagSet, test.args)
+		if strings.Join(positional, " ") != test.positional || user != test.user {
+			t.Errorf("parseArgs(%q) = %q, user %q, expected %q, user %q", test.args, positional, user, test.positional, test.user)
 		}
 	}
 }
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nerdctlRuntime drives containerd through the nerdctl CLI. containerd has no
+// Docker-compatible API, but nerdctl's inspect output uses the Docker schema.
+type nerdctlRuntime struct {
+	binary string
+}
+
+var _ Runtime = (*nerdctlRuntime)(nil)
+
+func newNerdctlRuntime() (*nerdctlRuntime, error) {
+	binary, err := exec.LookPath("nerdctl")
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl not found in PATH")
+	}
+	return &nerdctlRuntime{binary: binary}, nil
+}
+
+// Name identifies the backend in messages
+func (n *nerdctlRuntime) Name() string {
+	return "nerdctl"
+}
+
+// run executes nerdctl and returns stdout; stderr is folded into the error
+func (n *nerdctlRuntime) run(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, n.binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("nerdctl %s: %s", args[0], message)
+	}
+	return stdout.Bytes(), nil
+}
+
+// jsonLines decodes `--format '{{json .}}'` output, one object per line
+func jsonLines(data []byte, fn func([]byte) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ListContainers returns containers matching opts
+func (n *nerdctlRuntime) ListContainers(ctx context.Context, opts ListOptions) ([]Container, error) {
+	args := []string{"ps", "--format", "{{json .}}"}
+	if opts.All {
+		args = append(args, "--all")
+	}
+	if opts.Name != "" {
+		args = append(args, "--filter", "name="+opts.Name)
+	}
+	for _, label := range labelFilters(opts.Labels) {
+		args = append(args, "--filter", "label="+label)
+	}
+	output, err := n.run(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	statuses := map[string]string{}
+	err = jsonLines(output, func(line []byte) error {
+		var entry struct {
+			ID     string `json:"ID"`
+			Status string `json:"Status"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		ids = append(ids, entry.ID)
+		statuses[entry.ID] = entry.Status
+		return nil
+	})
+	if err != nil || len(ids) == 0 {
+		return []Container{}, err
+	}
+
+	containers, err := n.inspectContainers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range containers {
+		for id, status := range statuses {
+			if strings.HasPrefix(containers[i].ID, id) && status != "" {
+				containers[i].Status = status
+			}
+		}
+	}
+	return containers, nil
+}
+
+func (n *nerdctlRuntime) inspectContainers(ctx context.Context, ids []string) ([]Container, error) {
+	output, err := n.run(ctx, append([]string{"container", "inspect"}, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []dockerContainerInspect
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("nerdctl inspect: %w", err)
+	}
+	containers := make([]Container, 0, len(raw))
+	for _, inspect := range raw {
+		containers = append(containers, inspect.container())
+	}
+	return containers, nil
+}
+
+// InspectContainer returns a single container by name or ID
+func (n *nerdctlRuntime) InspectContainer(ctx context.Context, id string) (Container, error) {
+	containers, err := n.inspectContainers(ctx, []string{id})
+	if err != nil {
+		return Container{}, err
+	}
+	if len(containers) == 0 {
+		return Container{}, fmt.Errorf("no such container: %s", id)
+	}
+	return containers[0], nil
+}
+
+// CreateContainer creates a container attached to all of its networks
+func (n *nerdctlRuntime) CreateContainer(ctx context.Context, config ContainerConfig) (string, error) {
+	args := []string{"create", "--name", config.Name, "--hostname", config.Hostname}
+	if config.RestartPolicy != "" {
+		args = append(args, "--restart", config.RestartPolicy)
+	}
+	for _, env := range config.Env {
+		args = append(args, "--env", env)
+	}
+	for _, key := range sortedKeys(config.Labels) {
+		args = append(args, "--label", key+"="+config.Labels[key])
+	}
+	for _, port := range config.Ports {
+		mapping := fmt.Sprintf("%d:%d/%s", port.HostPort, port.ContainerPort, port.Protocol)
+		if port.HostIP != "" {
+			mapping = port.HostIP + ":" + mapping
+		}
+		args = append(args, "--publish", mapping)
+	}
+	for _, mount := range config.Mounts {
+		args = append(args, "--volume", mount.Volume+":"+mount.Target)
+	}
+	for _, network := range config.Networks {
+		args = append(args, "--network", network)
+	}
+	args = append(args, config.Image)
+
+	output, err := n.run(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// StartContainer starts a container
+func (n *nerdctlRuntime) StartContainer(ctx context.Context, id string) error {
+	_, err := n.run(ctx, "start", id)
+	return err
+}
+
+// StopContainer stops a container, killing it after timeout
+func (n *nerdctlRuntime) StopContainer(ctx context.Context, id string, timeout time.Duration) error {
+	_, err := n.run(ctx, "stop", "--time", strconv.Itoa(int(timeout.Seconds())), id)
+	return err
+}
+
+// RemoveContainer force-removes a container, leaving its named volumes in place
+func (n *nerdctlRuntime) RemoveContainer(ctx context.Context, id string) error {
+	_, err := n.run(ctx, "rm", "--force", id)
+	return err
+}
+
+// Exec runs cmd in a running container and returns its exit code
+func (n *nerdctlRuntime) Exec(ctx context.Context, id string, cmd []string, stdout, stderr io.Writer) (int, error) {
+	command := exec.CommandContext(ctx, n.binary, append([]string{"exec", id}, cmd...)...)
+	command.Stdout = stdout
+	command.Stderr = stderr
+	err := command.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// ContainerLogs streams the container's output with timestamps
+func (n *nerdctlRuntime) ContainerLogs(ctx context.Context, id string, opts LogOptions, stdout, stderr io.Writer) error {
+	args := []string{"logs", "--timestamps"}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, "--since", opts.Since.Format(time.RFC3339))
+	}
+	command := exec.CommandContext(ctx, n.binary, append(args, id)...)
+	command.Stdout = stdout
+	command.Stderr = stderr
+	if err := command.Run(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("nerdctl logs: %w", err)
+	}
+	return nil
+}
+
+// ListNetworks returns networks matching opts. Labels are matched on the
+// inspect output, which every nerdctl version reports.
+func (n *nerdctlRuntime) ListNetworks(ctx context.Context, opts ListOptions) ([]Network, error) {
+	output, err := n.run(ctx, "network", "ls", "--format", "{{json .}}")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	err = jsonLines(output, func(line []byte) error {
+		var entry struct {
+			Name string `json:"Name"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return err
+		}
+		if strings.Contains(entry.Name, opts.Name) {
+			names = append(names, entry.Name)
+		}
+		return nil
+	})
+	if err != nil || len(names) == 0 {
+		return []Network{}, err
+	}
+
+	output, err = n.run(ctx, append([]string{"network", "inspect"}, names...)...)
+	if err != nil {
+		return nil, err
+	}
+	var raw []dockerNetwork
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("nerdctl network inspect: %w", err)
+	}
+	networks := make([]Network, 0, len(raw))
+	for _, network := range raw {
+		if matchLabels(network.Labels, opts.Labels) {
+			networks = append(networks, network.network())
+		}
+	}
+	return networks, nil
+}
+
+// CreateNetwork creates a bridge network, optionally with a fixed subnet
+func (n *nerdctlRuntime) CreateNetwork(ctx context.Context, name, subnet string, labels map[string]string) error {
+	args := []string{"network", "create", "--driver", "bridge"}
+	if subnet != "" {
+		args = append(args, "--subnet", subnet)
+	}
+	for _, key := range sortedKeys(labels) {
+		args = append(args, "--label", key+"="+labels[key])
+	}
+	_, err := n.run(ctx, append(args, name)...)
+	return err
+}
+
+// RemoveNetwork removes a network by name
+func (n *nerdctlRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	_, err := n.run(ctx, "network", "rm", name)
+	return err
+}
+
+// ListVolumes returns volumes matching opts
+func (n *nerdctlRuntime) ListVolumes(ctx context.Context, opts ListOptions) ([]Volume, error) {
+	output, err := n.run(ctx, "volume", "ls", "--quiet")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, volume := range strings.Fields(string(output)) {
+		if strings.Contains(volume, opts.Name) {
+			names = append(names, volume)
+		}
+	}
+	if len(names) == 0 {
+		return []Volume{}, nil
+	}
+
+	output, err = n.run(ctx, append([]string{"volume", "inspect"}, names...)...)
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Name   string            `json:"Name"`
+		Labels map[string]string `json:"Labels"`
+	}
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("nerdctl volume inspect: %w", err)
+	}
+	volumes := make([]Volume, 0, len(raw))
+	for _, volume := range raw {
+		if matchLabels(volume.Labels, opts.Labels) {
+			volumes = append(volumes, Volume{Name: volume.Name, Labels: volume.Labels})
+		}
+	}
+	return volumes, nil
+}
+
+// CreateVolume creates a named volume; creating an existing volume is not an error
+func (n *nerdctlRuntime) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	if _, err := n.run(ctx, "volume", "inspect", name); err == nil {
+		return nil
+	}
+
+	args := []string{"volume", "create"}
+	for _, key := range sortedKeys(labels) {
+		args = append(args, "--label", key+"="+labels[key])
+	}
+	_, err := n.run(ctx, append(args, name)...)
+	return err
+}
+
+// RemoveVolume removes a named volume
+func (n *nerdctlRuntime) RemoveVolume(ctx context.Context, name string) error {
+	_, err := n.run(ctx, "volume", "rm", name)
+	return err
+}
+
+// ImageExists reports whether ref is present locally
+func (n *nerdctlRuntime) ImageExists(ctx context.Context, ref string) (bool, error) {
+	_, err := n.run(ctx, "image", "inspect", ref)
+	return err == nil, nil
+}
+
+// ImageID returns the ID of the local image ref
+func (n *nerdctlRuntime) ImageID(ctx context.Context, ref string) (string, error) {
+	output, err := n.run(ctx, "image", "inspect", ref)
+	if err != nil {
+		return "", err
+	}
+	var raw []struct {
+		ID string `json:"Id"`
+	}
+	if err := json.Unmarshal(output, &raw); err != nil || len(raw) == 0 {
+		return "", fmt.Errorf("nerdctl image inspect %s: unexpected output", ref)
+	}
+	return raw[0].ID, nil
+}
+
+// ImageLabels returns the labels of the local image ref
+func (n *nerdctlRuntime) ImageLabels(ctx context.Context, ref string) (map[string]string, error) {
+	output, err := n.run(ctx, "image", "inspect", ref)
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(output, &raw); err != nil || len(raw) == 0 {
+		return nil, fmt.Errorf("nerdctl image inspect %s: unexpected output", ref)
+	}
+	return raw[0].Config.Labels, nil
+}
+
+// BuildImage builds contextDir with BuildKit and tags the result as tag
+func (n *nerdctlRuntime) BuildImage(ctx context.Context, contextDir, tag string, labels map[string]string) error {
+	args := []string{"build", "--tag", tag}
+	for _, key := range sortedKeys(labels) {
+		args = append(args, "--label", key+"="+labels[key])
+	}
+	_, err := n.run(ctx, append(args, contextDir)...)
+	return err
+}
+
+// PullImage pulls ref from its registry
+func (n *nerdctlRuntime) PullImage(ctx context.Context, ref string) error {
+	_, err := n.run(ctx, "pull", "--quiet", ref)
+	return err
+}
+
+// RemoveImage removes a local image
+func (n *nerdctlRuntime) RemoveImage(ctx context.Context, ref string) error {
+	_, err := n.run(ctx, "rmi", ref)
+	return err
+}
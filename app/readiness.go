@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultWaitTimeout bounds how long init and start wait for nodes to become ready
+const defaultWaitTimeout = 60 * time.Second
+
+// Readiness polling backs off from the initial interval up to the maximum
+var (
+	readinessInitialBackoff = 250 * time.Millisecond
+	readinessMaxBackoff     = 2 * time.Second
+)
+
+// nodeReadiness is the outcome of waiting for one node
+type nodeReadiness struct {
+	Node     string
+	Duration time.Duration
+	Attempts int
+	Err      error // last probe error when the node never became ready
+}
+
+// probeNode checks once whether the node published on port is ready: sshd
+// must answer with its banner, or the readiness probe command must succeed
+func (a *App) probeNode(ctx context.Context, spec *LabSpec, port int) error {
+	target := a.sshTarget(spec, port)
+	if a.ReadinessProbe == "" {
+		_, err := a.SSH.Banner(ctx, target)
+		return err
+	}
+	_, err := a.SSH.Run(ctx, target, a.ReadinessProbe)
+	return err
+}
+
+// waitForNode polls a node with exponential backoff until it is ready or ctx ends
+func (a *App) waitForNode(ctx context.Context, spec *LabSpec, node string, port int) nodeReadiness {
+	result := nodeReadiness{Node: node}
+	start := time.Now()
+	backoff := readinessInitialBackoff
+	for {
+		result.Attempts++
+		err := a.probeNode(ctx, spec, port)
+		if err == nil {
+			result.Err = nil
+			result.Duration = time.Since(start)
+			return result
+		}
+		// A probe cut short by the deadline says less than the one before it
+		if result.Err == nil || ctx.Err() == nil {
+			result.Err = err
+		}
+
+		select {
+		case <-ctx.Done():
+			result.Duration = time.Since(start)
+			return result
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > readinessMaxBackoff {
+			backoff = readinessMaxBackoff
+		}
+	}
+}
+
+// waitForLab waits until every running node of the lab is ready, reporting
+// each node as it becomes ready. A zero WaitTimeout skips the wait.
+func (a *App) waitForLab(ctx context.Context, spec *LabSpec) error {
+	if a.WaitTimeout <= 0 {
+		return nil
+	}
+
+	containers, err := a.getContainers(ctx, spec)
+	if err != nil {
+		return err
+	}
+	ports := map[string]int{}
+	var nodes []string
+	for _, container := range containers {
+		if port := spec.containerSSHPort(container); port != 0 {
+			node := spec.nodeName(container)
+			ports[node] = port
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	check := "accept SSH"
+	if a.ReadinessProbe != "" {
+		check = fmt.Sprintf("pass %q", a.ReadinessProbe)
+	}
+	fmt.Fprintf(a.Out, "%s Waiting up to %s for %d nodes to %s...\n", cyan("⏳"), a.WaitTimeout, len(nodes), check)
+
+	waitCtx, cancel := context.WithTimeout(ctx, a.WaitTimeout)
+	defer cancel()
+
+	results := make(chan nodeReadiness, len(nodes))
+	for _, node := range nodes {
+		go func(node string) {
+			results <- a.waitForNode(waitCtx, spec, node, ports[node])
+		}(node)
+	}
+
+	var notReady []string
+	for range nodes {
+		result := <-results
+		if result.Err != nil {
+			notReady = append(notReady, fmt.Sprintf("%s (%s)", result.Node, readinessReason(result.Err)))
+			fmt.Fprintf(a.Out, "  %s %s %s (%s)\n", blue("→"), bold(result.Node), red("NOT READY"), readinessReason(result.Err))
+			continue
+		}
+		fmt.Fprintf(a.Out, "  %s %s %s in %s (%d attempts)\n", blue("→"), bold(result.Node), green("READY"), formatLatency(result.Duration), result.Attempts)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(notReady) > 0 {
+		return fmt.Errorf("%d of %d nodes not ready after %s: %s - check the container logs or raise --wait-timeout",
+			len(notReady), len(nodes), a.WaitTimeout, strings.Join(notReady, ", "))
+	}
+	return nil
+}
+
+// readinessReason describes why the last probe of a node failed
+func readinessReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return reasonTimeout
+	}
+	return sshReason(err)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withFastBackoff(t *testing.T) {
+	initial, max := readinessInitialBackoff, readinessMaxBackoff
+	readinessInitialBackoff, readinessMaxBackoff = time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() { readinessInitialBackoff, readinessMaxBackoff = initial, max })
+}
+
+func TestWaitForLabPollsUntilReady(t *testing.T) {
+	withFastBackoff(t)
+	app, rt, dialer, out := newTestApp()
+	app.WaitTimeout = time.Second
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	dialer.starting = map[int]int{2223: 3}
+
+	if err := app.waitForLab(context.Background(), defaultSpec(defaultLabName, 2)); err != nil {
+		t.Fatalf("waitForLab unexpected error: %v", err)
+	}
+	if dialer.banners[2222] != 1 || dialer.banners[2223] != 4 {
+		t.Errorf("banner probes = %v, expected 1 for lab-01 and 4 for lab-02", dialer.banners)
+	}
+	if !strings.Contains(out.String(), "lab-02 READY") || !strings.Contains(out.String(), "(4 attempts)") {
+		t.Errorf("output should report lab-02 ready after 4 attempts:\n%s", out.String())
+	}
+}
+
+func TestWaitForLabTimesOut(t *testing.T) {
+	withFastBackoff(t)
+	app, rt, dialer, out := newTestApp()
+	app.WaitTimeout = 50 * time.Millisecond
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	dialer.failures = map[int]error{2223: &SSHError{Reason: reasonRefused, Err: errors.New("dial tcp 127.0.0.1:2223")}}
+
+	err := app.waitForLab(context.Background(), defaultSpec(defaultLabName, 2))
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 nodes not ready after 50ms: lab-02 (connection refused)") {
+		t.Errorf("waitForLab error = %v, expected lab-02 to time out as connection refused", err)
+	}
+	if !strings.Contains(out.String(), "lab-01 READY") || !strings.Contains(out.String(), "lab-02 NOT READY") {
+		t.Errorf("output should report each node:\n%s", out.String())
+	}
+}
+
+func TestWaitForLabRunsProbe(t *testing.T) {
+	app, rt, dialer, _ := newTestApp()
+	app.WaitTimeout = time.Second
+	app.ReadinessProbe = "systemctl is-system-running"
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+
+	if err := app.waitForLab(context.Background(), defaultSpec(defaultLabName, 1)); err != nil {
+		t.Fatalf("waitForLab unexpected error: %v", err)
+	}
+	if len(dialer.commands) != 1 || !strings.HasSuffix(dialer.commands[0], "systemctl is-system-running") || len(dialer.banners) != 0 {
+		t.Errorf("commands = %v, banners = %v, expected only the probe command", dialer.commands, dialer.banners)
+	}
+}
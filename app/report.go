@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// reportFormats lists the supported `test --output` values
+var reportFormats = []string{"json", "junit", "tap"}
+
+// Test case statuses
+const (
+	statusPassed  = "passed"
+	statusFailed  = "failed"
+	statusSkipped = "skipped"
+)
+
+// testCase is a single connectivity check in a test report
+type testCase struct {
+	Suite    string // ssh or ansible
+	Name     string
+	Status   string
+	Duration time.Duration
+	Message  string // failure reason or skip explanation
+	Detail   string // full error or command output
+}
+
+// testReport collects the checks run by `lab test`
+type testReport struct {
+	Lab      string
+	Duration time.Duration
+	Cases    []testCase
+}
+
+// count returns the number of cases with status
+func (r *testReport) count(status string) int {
+	n := 0
+	for _, c := range r.Cases {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// write renders the report in format
+func (r *testReport) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return r.writeJSON(w)
+	case "junit":
+		return r.writeJUnit(w)
+	case "tap":
+		return r.writeTAP(w)
+	}
+	return fmt.Errorf("unknown output format %q (supported: %s)", format, strings.Join(reportFormats, ", "))
+}
+
+func (r *testReport) writeJSON(w io.Writer) error {
+	type jsonCase struct {
+		Suite      string `json:"suite"`
+		Name       string `json:"name"`
+		Status     string `json:"status"`
+		DurationMS int64  `json:"duration_ms"`
+		Message    string `json:"message,omitempty"`
+		Detail     string `json:"detail,omitempty"`
+	}
+	report := struct {
+		Lab        string     `json:"lab"`
+		Passed     bool       `json:"passed"`
+		DurationMS int64      `json:"duration_ms"`
+		Total      int        `json:"total"`
+		Failed     int        `json:"failed"`
+		Skipped    int        `json:"skipped"`
+		Tests      []jsonCase `json:"tests"`
+	}{
+		Lab:        r.Lab,
+		Passed:     r.count(statusFailed) == 0,
+		DurationMS: r.Duration.Milliseconds(),
+		Total:      len(r.Cases),
+		Failed:     r.count(statusFailed),
+		Skipped:    r.count(statusSkipped),
+		Tests:      []jsonCase{},
+	}
+	for _, c := range r.Cases {
+		report.Tests = append(report.Tests, jsonCase{c.Suite, c.Name, c.Status, c.Duration.Milliseconds(), c.Message, c.Detail})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func (r *testReport) writeJUnit(w io.Writer) error {
+	type junitMessage struct {
+		Message string `xml:"message,attr,omitempty"`
+		Text    string `xml:",chardata"`
+	}
+	type junitCase struct {
+		Classname string        `xml:"classname,attr"`
+		Name      string        `xml:"name,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitMessage `xml:"failure,omitempty"`
+		Skipped   *junitMessage `xml:"skipped,omitempty"`
+	}
+	type junitSuite struct {
+		Name     string      `xml:"name,attr"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Skipped  int         `xml:"skipped,attr"`
+		Time     string      `xml:"time,attr"`
+		Cases    []junitCase `xml:"testcase"`
+	}
+	type junitSuites struct {
+		XMLName xml.Name     `xml:"testsuites"`
+		Suites  []junitSuite `xml:"testsuite"`
+	}
+
+	suite := junitSuite{
+		Name:     "lab." + r.Lab,
+		Tests:    len(r.Cases),
+		Failures: r.count(statusFailed),
+		Skipped:  r.count(statusSkipped),
+		Time:     junitSeconds(r.Duration),
+	}
+	for _, c := range r.Cases {
+		junit := junitCase{Classname: "lab." + r.Lab + "." + c.Suite, Name: c.Name, Time: junitSeconds(c.Duration)}
+		switch c.Status {
+		case statusFailed:
+			junit.Failure = &junitMessage{Message: c.Message, Text: c.Detail}
+		case statusSkipped:
+			junit.Skipped = &junitMessage{Message: c.Message}
+		}
+		suite.Cases = append(suite.Cases, junit)
+	}
+
+	io.WriteString(w, xml.Header)
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeTAP renders TAP version 13 with YAML diagnostics for failures
+func (r *testReport) writeTAP(w io.Writer) error {
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%d\n", len(r.Cases))
+	for i, c := range r.Cases {
+		name := c.Suite + " " + c.Name
+		switch c.Status {
+		case statusPassed:
+			fmt.Fprintf(w, "ok %d - %s\n", i+1, name)
+		case statusSkipped:
+			fmt.Fprintf(w, "ok %d - %s # SKIP %s\n", i+1, name, c.Message)
+			continue
+		default:
+			fmt.Fprintf(w, "not ok %d - %s\n", i+1, name)
+		}
+
+		fmt.Fprintln(w, "  ---")
+		fmt.Fprintf(w, "  duration_ms: %d\n", c.Duration.Milliseconds())
+		if c.Status == statusFailed {
+			fmt.Fprintf(w, "  message: %s\n", yamlString(c.Message))
+			if c.Detail != "" {
+				fmt.Fprintf(w, "  detail: %s\n", yamlString(c.Detail))
+			}
+		}
+		fmt.Fprintln(w, "  ...")
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleReport() *testReport {
+	return &testReport{
+		Lab:      "web",
+		Duration: 1500 * time.Millisecond,
+		Cases: []testCase{
+			{Suite: "ssh", Name: "web-01", Status: statusPassed, Duration: 40 * time.Millisecond},
+			{Suite: "ssh", Name: "web-02", Status: statusFailed, Duration: 2 * time.Millisecond, Message: "connection refused", Detail: "port 2223: dial tcp"},
+			{Suite: "ansible", Name: "ping", Status: statusSkipped, Message: "Ansible not installed"},
+		},
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().write(&buf, "json"); err != nil {
+		t.Fatalf("write json: %v", err)
+	}
+
+	var decoded struct {
+		Lab     string `json:"lab"`
+		Passed  bool   `json:"passed"`
+		Total   int    `json:"total"`
+		Failed  int    `json:"failed"`
+		Skipped int    `json:"skipped"`
+		Tests   []struct {
+			Name       string `json:"name"`
+			Status     string `json:"status"`
+			DurationMS int64  `json:"duration_ms"`
+			Message    string `json:"message"`
+		} `json:"tests"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("report is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if decoded.Lab != "web" || decoded.Passed || decoded.Total != 3 || decoded.Failed != 1 || decoded.Skipped != 1 {
+		t.Errorf("summary = %+v, expected 3 tests with 1 failed and 1 skipped", decoded)
+	}
+	if test := decoded.Tests[1]; test.Name != "web-02" || test.Status != statusFailed || test.DurationMS != 2 || test.Message != "connection refused" {
+		t.Errorf("tests[1] = %+v, expected the failed web-02 check", test)
+	}
+}
+
+func TestReportJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().write(&buf, "junit"); err != nil {
+		t.Fatalf("write junit: %v", err)
+	}
+
+	var decoded struct {
+		Suites []struct {
+			Name     string `xml:"name,attr"`
+			Tests    int    `xml:"tests,attr"`
+			Failures int    `xml:"failures,attr"`
+			Cases    []struct {
+				Classname string `xml:"classname,attr"`
+				Name      string `xml:"name,attr"`
+				Time      string `xml:"time,attr"`
+				Failure   *struct {
+					Message string `xml:"message,attr"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("report is not valid XML: %v\n%s", err, buf.String())
+	}
+	if len(decoded.Suites) != 1 || decoded.Suites[0].Tests != 3 || decoded.Suites[0].Failures != 1 {
+		t.Fatalf("suites = %+v, expected one suite with 3 tests and 1 failure", decoded.Suites)
+	}
+	failed := decoded.Suites[0].Cases[1]
+	if failed.Classname != "lab.web.ssh" || failed.Time != "0.002" || failed.Failure == nil || failed.Failure.Message != "connection refused" {
+		t.Errorf("testcase = %+v, expected web-02 failing with connection refused", failed)
+	}
+	if !strings.Contains(buf.String(), `<skipped message="Ansible not installed">`) {
+		t.Errorf("junit report should mark the Ansible ping as skipped:\n%s", buf.String())
+	}
+}
+
+func TestReportTAP(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().write(&buf, "tap"); err != nil {
+		t.Fatalf("write tap: %v", err)
+	}
+
+	expected := []string{
+		"TAP version 13\n1..3\n",
+		"ok 1 - ssh web-01\n",
+		"not ok 2 - ssh web-02\n  ---\n  duration_ms: 2\n  message: \"connection refused\"\n",
+		"ok 3 - ansible ping # SKIP Ansible not installed\n",
+	}
+	for _, want := range expected {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("tap report missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestTestConnectivityWritesReport(t *testing.T) {
+	app, rt, dialer, out := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	dialer.failures = map[int]error{2223: &SSHError{Reason: reasonAuth, Err: errors.New("unable to authenticate")}}
+	app.Ansible = func(ctx context.Context, inventoryPath string) (string, error) {
+		return "lab-01 | SUCCESS", nil
+	}
+
+	var report bytes.Buffer
+	err := app.testConnectivity(context.Background(), defaultSpec(defaultLabName, 2), testOptions{Parallel: 2, Format: "tap", Report: &report})
+	if err == nil {
+		t.Errorf("testConnectivity expected an error for the failed node")
+	}
+
+	if !strings.Contains(report.String(), "1..3\nok 1 - ssh lab-01\n") || !strings.Contains(report.String(), "not ok 2 - ssh lab-02") || !strings.Contains(report.String(), "ok 3 - ansible ping\n") {
+		t.Errorf("report should cover both nodes and the Ansible ping:\n%s", report.String())
+	}
+	if strings.Contains(out.String(), "TAP version") {
+		t.Errorf("report leaked into the progress output:\n%s", out.String())
+	}
+}
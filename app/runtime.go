@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Runtime is a container engine backend. Every command goes through this
+// interface, so docker, podman and nerdctl behave the same way.
+type Runtime interface {
+	// Name identifies the backend in messages, e.g. "docker"
+	Name() string
+
+	ListContainers(ctx context.Context, opts ListOptions) ([]Container, error)
+	InspectContainer(ctx context.Context, id string) (Container, error)
+	CreateContainer(ctx context.Context, config ContainerConfig) (string, error)
+	StartContainer(ctx context.Context, id string) error
+	StopContainer(ctx context.Context, id string, timeout time.Duration) error
+	RemoveContainer(ctx context.Context, id string) error
+	// Exec runs cmd in a running container and returns its exit code
+	Exec(ctx context.Context, id string, cmd []string, stdout, stderr io.Writer) (int, error)
+	// ContainerLogs writes the output of the container's main process, each
+	// line prefixed with its RFC 3339 timestamp
+	ContainerLogs(ctx context.Context, id string, opts LogOptions, stdout, stderr io.Writer) error
+
+	ListNetworks(ctx context.Context, opts ListOptions) ([]Network, error)
+	CreateNetwork(ctx context.Context, name, subnet string, labels map[string]string) error
+	RemoveNetwork(ctx context.Context, name string) error
+
+	ListVolumes(ctx context.Context, opts ListOptions) ([]Volume, error)
+	CreateVolume(ctx context.Context, name string, labels map[string]string) error
+	RemoveVolume(ctx context.Context, name string) error
+
+	ImageExists(ctx context.Context, ref string) (bool, error)
+	// ImageID returns the content-addressed ID of a local image
+	ImageID(ctx context.Context, ref string) (string, error)
+	// ImageLabels returns the labels of a local image
+	ImageLabels(ctx context.Context, ref string) (map[string]string, error)
+	BuildImage(ctx context.Context, contextDir, tag string, labels map[string]string) error
+	PullImage(ctx context.Context, ref string) error
+	RemoveImage(ctx context.Context, ref string) error
+}
+
+// runtimeNames lists the supported --runtime values
+var runtimeNames = []string{"docker", "podman", "nerdctl"}
+
+// newRuntime returns the named backend; an empty name uses LAB_RUNTIME or auto-detection
+func newRuntime(name string) (Runtime, error) {
+	if name == "" {
+		name = os.Getenv("LAB_RUNTIME")
+	}
+	if name == "" {
+		name = detectRuntime()
+	}
+
+	switch name {
+	case "docker":
+		return newDockerClient("")
+	case "podman":
+		return newPodmanClient("")
+	case "nerdctl":
+		return newNerdctlRuntime()
+	default:
+		return nil, fmt.Errorf("unknown runtime %q (supported: %s)", name, strings.Join(runtimeNames, ", "))
+	}
+}
+
+// detectRuntime picks the first available backend: an explicit DOCKER_HOST or
+// the Docker socket, then a Podman socket, then nerdctl on PATH. Docker is the
+// fallback so the error message points at the most common setup.
+func detectRuntime() string {
+	if os.Getenv("DOCKER_HOST") != "" {
+		return "docker"
+	}
+	if _, err := os.Stat(strings.TrimPrefix(defaultDockerHost, "unix://")); err == nil {
+		return "docker"
+	}
+	if podmanHost() != "" {
+		return "podman"
+	}
+	if _, err := exec.LookPath("nerdctl"); err == nil {
+		return "nerdctl"
+	}
+	return "docker"
+}
+
+// Container is a lab container as reported by the container engine
+type Container struct {
+	ID      string
+	Name    string
+	Image   string
+	State   string // running, exited, created, ...
+	Status  string // human readable, e.g. "Up 5 minutes"
+	Labels  map[string]string
+	Ports   []PortBinding
+	Created time.Time
+}
+
+// PortBinding maps a container port to a port published on the host
+type PortBinding struct {
+	HostIP        string
+	HostPort      int
+	ContainerPort int
+	Protocol      string
+}
+
+// Network is a container network
+type Network struct {
+	ID      string
+	Name    string
+	Labels  map[string]string
+	Subnets []string
+}
+
+// Volume is a named container volume
+type Volume struct {
+	Name   string
+	Labels map[string]string
+}
+
+// Mount attaches a named volume to a path inside a container
+type Mount struct {
+	Volume string
+	Target string
+}
+
+// ContainerConfig describes a container to create
+type ContainerConfig struct {
+	Name          string
+	Hostname      string
+	Image         string
+	Env           []string
+	Labels        map[string]string
+	Ports         []PortBinding
+	Mounts        []Mount
+	Networks      []string
+	RestartPolicy string
+}
+
+// LogOptions selects the container output ContainerLogs returns
+type LogOptions struct {
+	Follow bool      // keep streaming new output until the context ends
+	Since  time.Time // only output written after this time, when set
+}
+
+// ListOptions filters container, network and volume listings
+type ListOptions struct {
+	All    bool              // include stopped containers
+	Name   string            // substring match on the resource name
+	Labels map[string]string // exact label matches; an empty value only requires the key
+}
+
+// labelFilters encodes labels as engine filter values, "key=value" or "key"
+func labelFilters(labels map[string]string) []string {
+	filters := []string{}
+	for _, key := range sortedKeys(labels) {
+		if labels[key] == "" {
+			filters = append(filters, key)
+		} else {
+			filters = append(filters, key+"="+labels[key])
+		}
+	}
+	return filters
+}
+
+// matchLabels reports whether labels satisfies every filter in want
+func matchLabels(labels, want map[string]string) bool {
+	for key, value := range want {
+		actual, ok := labels[key]
+		if !ok || (value != "" && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Running reports whether the container is up
+func (c Container) Running() bool {
+	return c.State == "running"
+}
+
+// SSHPort returns the host port published for 22/tcp, or 0 when SSH is not published.
+// IPv4 bindings are preferred; engines may report the same port for 0.0.0.0 and ::.
+func (c Container) SSHPort() int {
+	port := 0
+	for _, binding := range c.Ports {
+		if binding.ContainerPort != 22 || binding.Protocol != "tcp" || binding.HostPort == 0 {
+			continue
+		}
+		if port == 0 || !isIPv6(binding.HostIP) {
+			port = binding.HostPort
+		}
+	}
+	return port
+}
+
+func isIPv6(ip string) bool {
+	return strings.Contains(ip, ":")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// nodeTarget returns the SSH target of a running node, logging in as user.
+// An empty user is the lab user; root uses the root password and any other
+// account has to authenticate with the identity file.
+func (a *App) nodeTarget(ctx context.Context, spec *LabSpec, node, user string) (SSHTarget, error) {
+	containers, err := a.getContainers(ctx, spec)
+	if err != nil {
+		return SSHTarget{}, err
+	}
+	if len(containers) == 0 {
+		return SSHTarget{}, errNoContainers
+	}
+
+	var names []string
+	for _, container := range containers {
+		name := spec.nodeName(container)
+		names = append(names, name)
+		if name != node {
+			continue
+		}
+
+		port := spec.containerSSHPort(container)
+		if port == 0 {
+			return SSHTarget{}, fmt.Errorf("node %s does not publish an SSH port", node)
+		}
+		target := a.sshTarget(spec, port)
+		switch user {
+		case "", spec.User.Name:
+		case "root":
+			target.User = "root"
+			if *spec.User.PasswordAuth {
+				target.Password = spec.User.RootPassword
+			}
+		default:
+			target.User, target.Password = user, ""
+		}
+		return target, nil
+	}
+	return SSHTarget{}, fmt.Errorf("node %q is not running in lab %s (running: %s)", node, spec.Name, strings.Join(names, ", "))
+}
+
+// sshNode opens a session on node, an interactive shell with a PTY when
+// command is empty and standard input is a terminal. It returns the exit
+// status of the remote shell or command.
+func (a *App) sshNode(ctx context.Context, spec *LabSpec, node, user string, command []string, forwardAgent bool) (int, error) {
+	runner, ok := a.SSH.(shellRunner)
+	if !ok {
+		return 0, errors.New("the SSH client does not support interactive sessions")
+	}
+	target, err := a.nodeTarget(ctx, spec, node, user)
+	if err != nil {
+		return 0, err
+	}
+
+	stderr := a.errOut()
+	opts := ShellOptions{Command: strings.Join(command, " "), Stdin: a.In, Stdout: a.Out, Stderr: stderr}
+	if forwardAgent {
+		if opts.AgentSocket = os.Getenv("SSH_AUTH_SOCK"); opts.AgentSocket == "" {
+			fmt.Fprintf(stderr, "%s SSH_AUTH_SOCK is not set - agent forwarding disabled\n", yellow("⚠️"))
+		}
+	}
+
+	// A terminal on standard input gets a PTY that follows its size
+	if file, ok := a.In.(*os.File); ok && opts.Command == "" && term.IsTerminal(int(file.Fd())) {
+		fd := int(file.Fd())
+		opts.Term = os.Getenv("TERM")
+		if opts.Term == "" {
+			opts.Term = "xterm-256color"
+		}
+		opts.Width, opts.Height, _ = term.GetSize(fd)
+
+		resize := make(chan termSize, 1)
+		signals := make(chan os.Signal, 1)
+		done := make(chan struct{})
+		signal.Notify(signals, syscall.SIGWINCH)
+		defer signal.Stop(signals)
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-signals:
+				}
+				width, height, err := term.GetSize(fd)
+				if err != nil {
+					continue
+				}
+				// Only the latest size matters, so a size the session has
+				// not read yet is replaced rather than waited on
+				select {
+				case <-resize:
+				default:
+				}
+				select {
+				case resize <- termSize{Width: width, Height: height}:
+				default:
+				}
+			}
+		}()
+		opts.Resize = resize
+
+		fmt.Fprintf(stderr, "%s Connected to %s as %s\n", green("🔗"), bold(node), target.User)
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return 0, fmt.Errorf("failed to set up the terminal: %w", err)
+		}
+		defer term.Restore(fd, state)
+	}
+
+	return runner.Shell(ctx, target, opts)
+}
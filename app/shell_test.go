@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSSHNode(t *testing.T) {
+	app, rt, dialer, _ := newTestApp()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	spec := defaultSpec(defaultLabName, 2)
+	dialer.exitCodes = map[int]int{2223: 3}
+
+	code, err := app.sshNode(context.Background(), spec, "lab-02", "root", []string{"systemctl", "status", "nginx"}, false)
+	if err != nil || code != 3 {
+		t.Fatalf("sshNode = %d, %v, expected the remote exit status 3", code, err)
+	}
+	if dialer.shellUsers[0] != "root:"+spec.User.RootPassword+"@2223" || dialer.shells[0].Command != "systemctl status nginx" || dialer.shells[0].Term != "" {
+		t.Errorf("session = %s %+v, expected root on lab-02 running the command without a PTY", dialer.shellUsers[0], dialer.shells[0])
+	}
+
+	if _, err := app.sshNode(context.Background(), spec, "lab-01", "", nil, false); err != nil || dialer.shellUsers[1] != "labuser:"+spec.User.Password+"@2222" {
+		t.Errorf("sshNode(lab-01) = %v as %v, expected the lab user", err, dialer.shellUsers)
+	}
+
+	_, err = app.sshNode(context.Background(), spec, "lab-03", "", nil, false)
+	if err == nil || !strings.Contains(err.Error(), `node "lab-03" is not running in lab lab (running: lab-01, lab-02)`) {
+		t.Errorf("sshNode(lab-03) error = %v, expected the running nodes to be listed", err)
+	}
+}
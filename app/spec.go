@@ -0,0 +1,683 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// specVersion is the only lab.yaml schema version understood by this tool
+	specVersion = 1
+
+	defaultSpecFile = "lab.yaml"
+	defaultLabName  = "lab"
+	defaultImage    = "lab/image:latest"
+	defaultSSHBase  = 2222
+	// defaultSSHRangeSize is the number of ports from ssh_base that nodes may be moved to
+	defaultSSHRangeSize = 1000
+	defaultSubnet       = "172.20.0.0/16"
+	defaultNetwork      = "network"
+	defaultUser         = "labuser"
+)
+
+var (
+	labNamePattern    = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+	nodeNamePattern   = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	userNamePattern   = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	groupNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	varNamePattern    = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	objectNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	reservedGroups    = map[string]bool{"all": true, "ungrouped": true, "lab_environment": true, "lab_nodes": true}
+)
+
+// LabSpec is the declarative description of a lab, normally read from lab.yaml
+type LabSpec struct {
+	Version  int                  `yaml:"version"`
+	Name     string               `yaml:"name"`
+	Image    ImageSpec            `yaml:"image"`
+	User     UserSpec             `yaml:"user"`
+	Ports    PortsSpec            `yaml:"ports"`
+	Networks []NetworkSpec        `yaml:"networks"`
+	Volumes  []VolumeSpec         `yaml:"volumes"`
+	Nodes    []NodeSpec           `yaml:"nodes"`
+	Groups   map[string]GroupSpec `yaml:"groups"`
+
+	// source is the file the spec was loaded from, empty for the built-in default spec
+	source string
+
+	// ports holds the SSH host port allocated to each node, read back from the lab state
+	ports map[string]int
+
+	// keyFile is the lab's SSH private key and authorizedKey its public key
+	// line, both empty until the key is generated
+	keyFile       string
+	authorizedKey string
+}
+
+// ImageSpec selects the node image and, optionally, the build context used to produce it
+type ImageSpec struct {
+	Name  string `yaml:"name"`
+	Build string `yaml:"build"`
+}
+
+// UserSpec holds the credentials configured inside every node by entrypoint.sh
+type UserSpec struct {
+	Name         string `yaml:"name"`
+	Password     string `yaml:"password"`
+	RootPassword string `yaml:"root_password"`
+	Sudo         *bool  `yaml:"sudo"`
+	PasswordAuth *bool  `yaml:"password_auth"` // false allows only the lab key
+
+	// generatedPassword and generatedRootPassword are set when the spec left
+	// the password out and a random one was filled in
+	generatedPassword     bool
+	generatedRootPassword bool
+}
+
+// PortsSpec controls how SSH ports are published on the host
+type PortsSpec struct {
+	SSHBase  int    `yaml:"ssh_base"`
+	SSHRange string `yaml:"ssh_range"` // first-last, ports nodes move to when their preferred port is taken
+}
+
+// NetworkSpec describes a bridge network shared by the lab nodes
+type NetworkSpec struct {
+	Name   string `yaml:"name"`
+	Subnet string `yaml:"subnet"`
+}
+
+// VolumeSpec describes a persistent volume created for every node and mounted at Path
+type VolumeSpec struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+// NodeSpec describes a single lab container
+type NodeSpec struct {
+	Name     string            `yaml:"name"`
+	Image    string            `yaml:"image"`
+	SSHPort  int               `yaml:"ssh_port"`
+	Ports    []string          `yaml:"ports"`
+	Networks []string          `yaml:"networks"`
+	Env      map[string]string `yaml:"env"`
+	Vars     map[string]any    `yaml:"vars,omitempty"` // Ansible host vars
+
+	// pinnedPort is set when ssh_port was given in the spec, so it is never reassigned
+	pinnedPort bool
+}
+
+// GroupSpec is an Ansible inventory group. In lab.yaml it is either a list of
+// nodes or a mapping with hosts, child groups and vars.
+type GroupSpec struct {
+	Hosts    []string       `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	Children []string       `yaml:"children,omitempty" json:"children,omitempty"`
+	Vars     map[string]any `yaml:"vars,omitempty" json:"vars,omitempty"`
+}
+
+// UnmarshalYAML accepts both group forms, rejecting unknown fields of the mapping form
+func (g *GroupSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		return node.Decode(&g.Hosts)
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			switch key := node.Content[i]; key.Value {
+			case "hosts", "children", "vars":
+			default:
+				return fmt.Errorf("line %d: field %s not found in group (expected hosts, children or vars)", key.Line, key.Value)
+			}
+		}
+	}
+	type plain GroupSpec
+	return node.Decode((*plain)(g))
+}
+
+// MarshalYAML writes a group that only lists hosts in the list form
+func (g GroupSpec) MarshalYAML() (interface{}, error) {
+	if len(g.Children) == 0 && len(g.Vars) == 0 {
+		return g.Hosts, nil
+	}
+	type plain GroupSpec
+	return plain(g), nil
+}
+
+// SpecError lists every problem found while validating a lab spec
+type SpecError struct {
+	Source   string
+	Problems []string
+}
+
+func (e *SpecError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s is invalid:", e.Source)
+	for _, problem := range e.Problems {
+		fmt.Fprintf(&b, "\n  - %s", problem)
+	}
+	return b.String()
+}
+
+// defaultSpec returns the spec equivalent to `init --lab NAME --containers N`
+func defaultSpec(labName string, containerCount int) *LabSpec {
+	spec := &LabSpec{Version: specVersion, Name: labName}
+	for i := 1; i <= containerCount; i++ {
+		spec.Nodes = append(spec.Nodes, NodeSpec{Name: fmt.Sprintf("%s-%02d", labName, i)})
+	}
+	spec.applyDefaults()
+	return spec
+}
+
+// loadSpec reads, defaults and validates a lab spec file
+func loadSpec(path string) (*LabSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := parseSpec(data, path)
+	if err != nil {
+		return nil, err
+	}
+
+	spec.source = path
+	return spec, nil
+}
+
+// parseSpec decodes a lab spec, rejecting unknown fields, then applies defaults and validates it
+func parseSpec(data []byte, source string) (*LabSpec, error) {
+	spec := &LabSpec{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(spec); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, &SpecError{Source: source, Problems: []string{"file is empty"}}
+		}
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	spec.applyDefaults()
+	if err := spec.validate(source); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// resolveSpec picks the spec for a command: the spec file when present, otherwise
+// the default topology. An explicitly requested spec file must exist. A non-empty
+// labName overrides the name in the spec file.
+func resolveSpec(path string, explicit bool, labName string, containerCount int) (*LabSpec, error) {
+	if labName != "" && !labNamePattern.MatchString(labName) {
+		return nil, fmt.Errorf("--lab %q is not a valid lab name (lowercase letters, digits and dashes)", labName)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) && !explicit {
+			if labName == "" {
+				labName = defaultLabName
+			}
+			return defaultSpec(labName, containerCount), nil
+		}
+		return nil, err
+	}
+
+	spec, err := loadSpec(path)
+	if err != nil {
+		return nil, err
+	}
+	if labName != "" {
+		spec.Name = labName
+	}
+	return spec, nil
+}
+
+func (s *LabSpec) applyDefaults() {
+	if s.Name == "" {
+		s.Name = defaultLabName
+	}
+
+	if s.Image.Name == "" {
+		s.Image.Name = defaultImage
+		if s.Image.Build == "" {
+			s.Image.Build = "."
+		}
+	}
+
+	if s.User.Name == "" {
+		s.User.Name = defaultUser
+	}
+	if s.User.Password == "" {
+		s.User.Password, s.User.generatedPassword = randomPassword(), true
+	}
+	if s.User.RootPassword == "" {
+		s.User.RootPassword, s.User.generatedRootPassword = randomPassword(), true
+	}
+	if s.User.Sudo == nil {
+		sudo := true
+		s.User.Sudo = &sudo
+	}
+	if s.User.PasswordAuth == nil {
+		passwordAuth := true
+		s.User.PasswordAuth = &passwordAuth
+	}
+
+	if s.Ports.SSHBase == 0 {
+		s.Ports.SSHBase = defaultSSHBase
+	}
+	if s.Ports.SSHRange == "" {
+		s.Ports.SSHRange = fmt.Sprintf("%d-%d", s.Ports.SSHBase, min(s.Ports.SSHBase+defaultSSHRangeSize-1, 65535))
+	}
+
+	if len(s.Networks) == 0 {
+		s.Networks = []NetworkSpec{{Name: defaultNetwork}}
+		// Only the default lab pins a subnet; other labs let the engine pick a
+		// free one so several labs can run side by side
+		if s.Name == defaultLabName {
+			s.Networks[0].Subnet = defaultSubnet
+		}
+	}
+
+	if s.Volumes == nil {
+		s.Volumes = []VolumeSpec{
+			{Name: "home", Path: "/home"},
+			{Name: "services", Path: "/etc/systemd/system"},
+		}
+	}
+
+	for i := range s.Nodes {
+		node := &s.Nodes[i]
+		if node.SSHPort == 0 {
+			node.SSHPort = s.Ports.SSHBase + i
+		} else {
+			node.pinnedPort = true
+		}
+		if len(node.Networks) == 0 {
+			node.Networks = []string{s.Networks[0].Name}
+		}
+	}
+}
+
+func (s *LabSpec) validate(source string) error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	checkVars := func(field string, vars map[string]any) {
+		for _, name := range sortedKeys(vars) {
+			if !varNamePattern.MatchString(name) {
+				addf("%s: %q is not a valid Ansible variable name", field, name)
+			}
+		}
+	}
+
+	if s.Version == 0 {
+		addf("version: is required (current version is %d)", specVersion)
+	} else if s.Version != specVersion {
+		addf("version: unsupported version %d (expected %d)", s.Version, specVersion)
+	}
+
+	if !labNamePattern.MatchString(s.Name) {
+		addf("name: %q is not a valid lab name (lowercase letters, digits and dashes)", s.Name)
+	}
+
+	if !userNamePattern.MatchString(s.User.Name) {
+		addf("user.name: %q is not a valid user name", s.User.Name)
+	}
+
+	if _, _, err := parsePortRange(s.Ports.SSHRange); err != nil {
+		addf("ports.ssh_range: %v", err)
+	}
+	if !validPort(s.Ports.SSHBase) {
+		addf("ports.ssh_base: %d is not a valid port", s.Ports.SSHBase)
+	}
+
+	networks := map[string]bool{}
+	for i, network := range s.Networks {
+		field := fmt.Sprintf("networks[%d]", i)
+		if !objectNamePattern.MatchString(network.Name) {
+			addf("%s.name: %q is not a valid network name", field, network.Name)
+		} else if networks[network.Name] {
+			addf("%s.name: duplicate network %q", field, network.Name)
+		}
+		networks[network.Name] = true
+		if network.Subnet != "" {
+			if _, _, err := net.ParseCIDR(network.Subnet); err != nil {
+				addf("%s.subnet: %q is not a valid CIDR", field, network.Subnet)
+			}
+		}
+	}
+
+	volumeNames := map[string]bool{}
+	volumePaths := map[string]bool{}
+	for i, volume := range s.Volumes {
+		field := fmt.Sprintf("volumes[%d]", i)
+		if !objectNamePattern.MatchString(volume.Name) {
+			addf("%s.name: %q is not a valid volume name", field, volume.Name)
+		} else if volumeNames[volume.Name] {
+			addf("%s.name: duplicate volume %q", field, volume.Name)
+		}
+		volumeNames[volume.Name] = true
+		if !strings.HasPrefix(volume.Path, "/") {
+			addf("%s.path: %q must be an absolute path", field, volume.Path)
+		} else if volumePaths[volume.Path] {
+			addf("%s.path: %q is mounted twice", field, volume.Path)
+		}
+		volumePaths[volume.Path] = true
+	}
+
+	if len(s.Nodes) == 0 {
+		addf("nodes: at least one node is required")
+	}
+
+	nodes := map[string]bool{}
+	hostPorts := map[int]string{}
+	claimPort := func(field string, port int) {
+		if owner, taken := hostPorts[port]; taken {
+			addf("%s: host port %d is already used by %s", field, port, owner)
+			return
+		}
+		hostPorts[port] = field
+	}
+	for i, node := range s.Nodes {
+		field := fmt.Sprintf("nodes[%d]", i)
+		if !nodeNamePattern.MatchString(node.Name) {
+			addf("%s.name: %q is not a valid hostname", field, node.Name)
+		} else if nodes[node.Name] {
+			addf("%s.name: duplicate node %q", field, node.Name)
+		}
+		nodes[node.Name] = true
+
+		if !validPort(node.SSHPort) {
+			addf("%s.ssh_port: %d is not a valid port", field, node.SSHPort)
+		} else {
+			claimPort(field+".ssh_port", node.SSHPort)
+		}
+
+		for j, mapping := range node.Ports {
+			portField := fmt.Sprintf("%s.ports[%d]", field, j)
+			binding, err := parsePortMapping(mapping)
+			if err != nil {
+				addf("%s: %v", portField, err)
+				continue
+			}
+			claimPort(portField, binding.HostPort)
+		}
+
+		for j, network := range node.Networks {
+			if !networks[network] {
+				addf("%s.networks[%d]: unknown network %q", field, j, network)
+			}
+		}
+
+		for key := range node.Env {
+			if key == "" || strings.Contains(key, "=") {
+				addf("%s.env: %q is not a valid variable name", field, key)
+			}
+		}
+		checkVars(field+".vars", node.Vars)
+	}
+
+	for _, group := range s.groupNames() {
+		g := s.Groups[group]
+		field := "groups." + group
+		if !groupNamePattern.MatchString(group) {
+			addf("%s: %q is not a valid group name", field, group)
+		} else if reservedGroups[group] {
+			addf("%s: %q is reserved", field, group)
+		}
+		for _, member := range g.Hosts {
+			if !nodes[member] {
+				addf("%s: unknown node %q", field, member)
+			}
+		}
+		for _, child := range g.Children {
+			if _, ok := s.Groups[child]; !ok {
+				addf("%s.children: unknown group %q", field, child)
+			}
+		}
+		checkVars(field+".vars", g.Vars)
+	}
+	if cycle := s.groupCycle(); cycle != nil {
+		addf("groups: group cycle %s", strings.Join(cycle, " -> "))
+	}
+
+	if len(problems) > 0 {
+		return &SpecError{Source: source, Problems: problems}
+	}
+	return nil
+}
+
+// buildContext returns the image build context resolved against the spec directory
+func (s *LabSpec) buildContext() string {
+	if s.Image.Build == "" || filepath.IsAbs(s.Image.Build) || s.source == "" {
+		return s.Image.Build
+	}
+	return filepath.Join(filepath.Dir(s.source), s.Image.Build)
+}
+
+// qualify prefixes a node or network name with the lab name, so resources of
+// different labs never collide. Names that already carry the prefix are kept.
+func (s *LabSpec) qualify(name string) string {
+	if strings.HasPrefix(name, s.Name+"-") {
+		return name
+	}
+	return s.Name + "-" + name
+}
+
+// containerName returns the container name for a node
+func (s *LabSpec) containerName(node NodeSpec) string {
+	return s.qualify(node.Name)
+}
+
+// networkName returns the engine network name for a spec network
+func (s *LabSpec) networkName(network string) string {
+	return s.qualify(network)
+}
+
+// nodeName maps a container back to its node name, preferring the node label.
+// Containers without one that are not in the spec keep their container name.
+func (s *LabSpec) nodeName(container Container) string {
+	if node := container.Labels[labNodeLabel]; node != "" {
+		return node
+	}
+	for _, node := range s.Nodes {
+		if s.containerName(node) == container.Name {
+			return node.Name
+		}
+	}
+	return container.Name
+}
+
+// sshPort returns the SSH host port allocated to node, or its preferred port
+// before allocation
+func (s *LabSpec) sshPort(node NodeSpec) int {
+	if port, ok := s.ports[node.Name]; ok {
+		return port
+	}
+	return node.SSHPort
+}
+
+// containerSSHPort returns the SSH host port of a node container, preferring
+// the port recorded in the lab state over the runtime's port bindings, which
+// stopped containers may not report
+func (s *LabSpec) containerSSHPort(container Container) int {
+	if port, ok := s.ports[s.nodeName(container)]; ok {
+		return port
+	}
+	return container.SSHPort()
+}
+
+// groupNames returns the spec group names in sorted order
+func (s *LabSpec) groupNames() []string {
+	names := make([]string, 0, len(s.Groups))
+	for group := range s.Groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// groupCycle returns the first chain of child groups that leads back to a
+// group on it, such as [a b a], or nil when the groups form no cycle
+func (s *LabSpec) groupCycle() []string {
+	done := map[string]bool{}
+	var stack []string
+	var visit func(group string) []string
+	visit = func(group string) []string {
+		for i, name := range stack {
+			if name == group {
+				return append(append([]string{}, stack[i:]...), group)
+			}
+		}
+		if done[group] {
+			return nil
+		}
+		stack = append(stack, group)
+		for _, child := range s.Groups[group].Children {
+			if _, ok := s.Groups[child]; !ok {
+				continue
+			}
+			if cycle := visit(child); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		done[group] = true
+		return nil
+	}
+	for _, group := range s.groupNames() {
+		if cycle := visit(group); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// groupMembers returns the nodes of a group and of its child groups, in spec order
+func (s *LabSpec) groupMembers(group string) []string {
+	members := map[string]bool{}
+	visited := map[string]bool{}
+	var collect func(name string)
+	collect = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, host := range s.Groups[name].Hosts {
+			members[host] = true
+		}
+		for _, child := range s.Groups[name].Children {
+			collect(child)
+		}
+	}
+	collect(group)
+
+	var ordered []string
+	for _, node := range s.Nodes {
+		if members[node.Name] {
+			ordered = append(ordered, node.Name)
+			delete(members, node.Name)
+		}
+	}
+	// Groups recorded for a lab may name nodes the current spec does not have
+	return append(ordered, sortedKeys(members)...)
+}
+
+// node returns the spec of the named node
+func (s *LabSpec) node(name string) (NodeSpec, bool) {
+	for _, node := range s.Nodes {
+		if node.Name == name {
+			return node, true
+		}
+	}
+	return NodeSpec{}, false
+}
+
+// parseGroupFlag parses an init --group value, NAME=SEL, where SEL is a
+// comma-separated list of node numbers, ranges like 1-3 and node names
+func (s *LabSpec) parseGroupFlag(value string) (string, []string, error) {
+	name, selection, ok := strings.Cut(value, "=")
+	if !ok || name == "" || selection == "" {
+		return "", nil, fmt.Errorf("--group %q must look like web=1-3", value)
+	}
+	var hosts []string
+	for _, item := range strings.Split(selection, ",") {
+		item = strings.TrimSpace(item)
+		first, last := 0, 0
+		if from, to, isRange := strings.Cut(item, "-"); isRange {
+			var err1, err2 error
+			first, err1 = strconv.Atoi(from)
+			last, err2 = strconv.Atoi(to)
+			if err1 != nil || err2 != nil {
+				first, last = 0, 0
+			}
+		} else if n, err := strconv.Atoi(item); err == nil {
+			first, last = n, n
+		}
+		if first == 0 {
+			// Not a number or range, so a node name
+			hosts = append(hosts, item)
+			continue
+		}
+		if first < 1 || last < first || last > len(s.Nodes) {
+			return "", nil, fmt.Errorf("--group %s: %s is outside nodes 1-%d", name, item, len(s.Nodes))
+		}
+		for i := first; i <= last; i++ {
+			hosts = append(hosts, s.Nodes[i-1].Name)
+		}
+	}
+	return name, hosts, nil
+}
+
+// parsePortMapping parses and validates a "host:container[/proto]" mapping
+func parsePortMapping(mapping string) (PortBinding, error) {
+	spec, proto, hasProto := strings.Cut(mapping, "/")
+	if !hasProto {
+		proto = "tcp"
+	} else if proto != "tcp" && proto != "udp" {
+		return PortBinding{}, fmt.Errorf("%q has unsupported protocol %q", mapping, proto)
+	}
+
+	hostPart, containerPart, ok := strings.Cut(spec, ":")
+	if !ok {
+		return PortBinding{}, fmt.Errorf("%q must be in host:container form", mapping)
+	}
+
+	hostPort, err := strconv.Atoi(hostPart)
+	if err != nil || !validPort(hostPort) {
+		return PortBinding{}, fmt.Errorf("%q has an invalid host port", mapping)
+	}
+	containerPort, err := strconv.Atoi(containerPart)
+	if err != nil || !validPort(containerPort) {
+		return PortBinding{}, fmt.Errorf("%q has an invalid container port", mapping)
+	}
+	return PortBinding{HostPort: hostPort, ContainerPort: containerPort, Protocol: proto}, nil
+}
+
+// parsePortRange parses a "first-last" port range
+func parsePortRange(value string) (int, int, error) {
+	firstPart, lastPart, ok := strings.Cut(value, "-")
+	first, err1 := strconv.Atoi(strings.TrimSpace(firstPart))
+	last, err2 := strconv.Atoi(strings.TrimSpace(lastPart))
+	if !ok || err1 != nil || err2 != nil || !validPort(first) || !validPort(last) {
+		return 0, 0, fmt.Errorf("%q must be a port range like 2222-2999", value)
+	}
+	if first > last {
+		return 0, 0, fmt.Errorf("%q starts after it ends", value)
+	}
+	return first, last, nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSpecDefaults(t *testing.T) {
+	spec, err := parseSpec([]byte(`
+version: 1
+nodes:
+  - name: web-01
+  - name: web-02
+    ssh_port: 2300
+groups:
+  web: [web-01, web-02]
+`), "lab.yaml")
+	if err != nil {
+		t.Fatalf("parseSpec unexpected error: %v", err)
+	}
+
+	if spec.Image.Name != defaultImage || spec.Image.Build != "." {
+		t.Errorf("image = %+v, expected default image built from .", spec.Image)
+	}
+	if spec.User.Name != defaultUser || len(spec.User.Password) != passwordLength || !spec.User.generatedPassword || !*spec.User.Sudo {
+		t.Errorf("user = %+v, expected the default user with a random password and sudo", spec.User)
+	}
+	if spec.Nodes[0].SSHPort != defaultSSHBase || spec.Nodes[1].SSHPort != 2300 {
+		t.Errorf("ssh ports = %d, %d, expected %d, 2300", spec.Nodes[0].SSHPort, spec.Nodes[1].SSHPort, defaultSSHBase)
+	}
+	if spec.Ports.SSHRange != "2222-3221" || spec.Nodes[0].pinnedPort || !spec.Nodes[1].pinnedPort {
+		t.Errorf("ports = %+v, expected the default range with only web-02 pinned", spec.Ports)
+	}
+	if len(spec.Nodes[0].Networks) != 1 || spec.Nodes[0].Networks[0] != defaultNetwork {
+		t.Errorf("node networks = %v, expected [%s]", spec.Nodes[0].Networks, defaultNetwork)
+	}
+	if len(spec.Volumes) != 2 {
+		t.Errorf("volumes = %v, expected home and services", spec.Volumes)
+	}
+}
+
+func TestParseSpecErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"empty", ``, "file is empty"},
+		{"missing version", "nodes: [{name: a}]", "version: is required"},
+		{"future version", "version: 2\nnodes: [{name: a}]", "unsupported version 2"},
+		{"unknown field", "version: 1\nnode: []", "field node not found"},
+		{"no nodes", "version: 1", "at least one node is required"},
+		{"bad node name", "version: 1\nnodes: [{name: Lab_01}]", `nodes[0].name: "Lab_01" is not a valid hostname`},
+		{"duplicate node", "version: 1\nnodes: [{name: a}, {name: a}]", `nodes[1].name: duplicate node "a"`},
+		{"port clash", "version: 1\nnodes: [{name: a, ssh_port: 2000}, {name: b, ssh_port: 2000}]", "host port 2000 is already used by nodes[0].ssh_port"},
+		{"bad mapping", "version: 1\nnodes: [{name: a, ports: ['80']}]", "must be in host:container form"},
+		{"unknown network", "version: 1\nnodes: [{name: a, networks: [other]}]", `unknown network "other"`},
+		{"bad subnet", "version: 1\nnetworks: [{name: n, subnet: 10.0.0.0/33}]\nnodes: [{name: a}]", "is not a valid CIDR"},
+		{"relative volume", "version: 1\nvolumes: [{name: data, path: data}]\nnodes: [{name: a}]", "must be an absolute path"},
+		{"unknown member", "version: 1\nnodes: [{name: a}]\ngroups: {web: [b]}", `groups.web: unknown node "b"`},
+		{"bad ssh range", "version: 1\nports: {ssh_range: 3000-2000}\nnodes: [{name: a}]", `ports.ssh_range: "3000-2000" starts after it ends`},
+		{"bad lab name", "version: 1\nname: Web_Tier\nnodes: [{name: a}]", `name: "Web_Tier" is not a valid lab name`},
+		{"reserved group", "version: 1\nnodes: [{name: a}]\ngroups: {all: [a]}", `"all" is reserved`},
+		{"unknown group field", "version: 1\nnodes: [{name: a}]\ngroups: {web: {host: [a]}}", "field host not found in group"},
+		{"unknown child", "version: 1\nnodes: [{name: a}]\ngroups: {web: {children: [db]}}", `groups.web.children: unknown group "db"`},
+		{"group cycle", "version: 1\nnodes: [{name: a}]\ngroups: {web: {children: [app]}, app: {children: [web]}}", "groups: group cycle app -> web -> app"},
+		{"indirect group cycle", "version: 1\nnodes: [{name: a}]\ngroups: {x: {children: [a]}, a: {children: [b]}, b: {children: [a]}}", "groups: group cycle a -> b -> a"},
+		{"bad var name", "version: 1\nnodes: [{name: a, vars: {http-port: 80}}]", `nodes[0].vars: "http-port" is not a valid Ansible variable name`},
+	}
+
+	for _, test := range tests {
+		_, err := parseSpec([]byte(test.input), "lab.yaml")
+		if err == nil {
+			t.Errorf("%s: parseSpec expected error containing %q, got nil", test.name, test.expected)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: parseSpec error = %q, expected it to contain %q", test.name, err.Error(), test.expected)
+		}
+	}
+}
+
+func TestParseSpecGroups(t *testing.T) {
+	spec, err := parseSpec([]byte(`
+version: 1
+nodes:
+  - name: web-01
+    vars: {role: primary}
+  - name: web-02
+  - name: db-01
+groups:
+  web:
+    hosts: [web-02, web-01]
+    vars: {http_port: 8080}
+  db: [db-01]
+  app:
+    children: [web, db]
+`), "lab.yaml")
+	if err != nil {
+		t.Fatalf("parseSpec unexpected error: %v", err)
+	}
+	if spec.Groups["web"].Vars["http_port"] != 8080 || spec.Nodes[0].Vars["role"] != "primary" {
+		t.Errorf("groups = %+v, nodes = %+v, expected the group and node vars", spec.Groups, spec.Nodes)
+	}
+	if members := strings.Join(spec.groupMembers("app"), " "); members != "web-01 web-02 db-01" {
+		t.Errorf("groupMembers(app) = %s, expected the nodes of web and db in spec order", members)
+	}
+	// Groups that never went through validate must not recurse forever
+	cyclic := &LabSpec{Nodes: spec.Nodes, Groups: map[string]GroupSpec{"a": {Hosts: []string{"db-01"}, Children: []string{"b"}}, "b": {Children: []string{"a"}}}}
+	if members := strings.Join(cyclic.groupMembers("a"), " "); members != "db-01" {
+		t.Errorf("groupMembers(a) with a cycle = %s, expected db-01", members)
+	}
+
+	// A list of hosts hashes the same in both forms, so existing labs see no drift
+	list := defaultSpec(defaultLabName, 2)
+	list.Groups = map[string]GroupSpec{"web": {Hosts: []string{"lab-01"}}}
+	parsed, _ := parseSpec([]byte("version: 1\nname: lab\nnodes: [{name: lab-01}, {name: lab-02}]\ngroups:\n  web: {hosts: [lab-01]}\n"), "lab.yaml")
+	parsed.User = list.User
+	if specHash(parsed) != specHash(list) {
+		t.Errorf("specHash differs between the list and mapping forms of a group")
+	}
+}
+
+func TestParseGroupFlag(t *testing.T) {
+	spec := defaultSpec(defaultLabName, 5)
+	tests := []struct {
+		value    string
+		name     string
+		expected string
+	}{
+		{"web=1-3", "web", "lab-01 lab-02 lab-03"},
+		{"db=4", "db", "lab-04"},
+		{"lb=5,lab-01", "lb", "lab-05 lab-01"},
+	}
+	for _, test := range tests {
+		name, hosts, err := spec.parseGroupFlag(test.value)
+		if err != nil || name != test.name || strings.Join(hosts, " ") != test.expected {
+			t.Errorf("parseGroupFlag(%q) = %s, %v, %v; expected %s, %s", test.value, name, hosts, err, test.name, test.expected)
+		}
+	}
+	for _, value := range []string{"web", "web=", "web=4-6", "web=3-1"} {
+		if _, _, err := spec.parseGroupFlag(value); err == nil {
+			t.Errorf("parseGroupFlag(%q) expected an error", value)
+		}
+	}
+}
+
+func TestDefaultSpecMatchesContainerCount(t *testing.T) {
+	spec := defaultSpec(defaultLabName, 3)
+	if err := spec.validate("default"); err != nil {
+		t.Fatalf("defaultSpec(3) is invalid: %v", err)
+	}
+	if len(spec.Nodes) != 3 || spec.Nodes[2].Name != "lab-03" || spec.Nodes[2].SSHPort != 2224 {
+		t.Errorf("defaultSpec(3) nodes = %+v, expected lab-01..lab-03 on ports 2222-2224", spec.Nodes)
+	}
+}
+
+func TestResolveSpecLabName(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "lab.yaml")
+
+	spec, err := resolveSpec(missing, false, "db", 2)
+	if err != nil {
+		t.Fatalf("resolveSpec unexpected error: %v", err)
+	}
+	if spec.Name != "db" || spec.Nodes[0].Name != "db-01" || spec.Networks[0].Subnet != "" {
+		t.Errorf("spec = %+v, expected db-01.. on an engine-assigned subnet", spec)
+	}
+
+	path := filepath.Join(dir, "web.yaml")
+	os.WriteFile(path, []byte("version: 1\nname: web\nnodes: [{name: app}]\n"), 0644)
+	if spec, err := resolveSpec(path, true, "", 2); err != nil || spec.Name != "web" {
+		t.Errorf("resolveSpec(web.yaml) = %+v, %v, expected lab web", spec, err)
+	}
+	if spec, err := resolveSpec(path, true, "staging", 2); err != nil || spec.Name != "staging" || spec.containerName(spec.Nodes[0]) != "staging-app" {
+		t.Errorf("resolveSpec(web.yaml, --lab staging) = %+v, %v, expected lab staging", spec, err)
+	}
+
+	if _, err := resolveSpec(missing, false, "Bad Name", 2); err == nil {
+		t.Errorf("resolveSpec with an invalid --lab expected error, got nil")
+	}
+}
+
+func TestSpecHash(t *testing.T) {
+	spec := defaultSpec(defaultLabName, 2)
+	if specHash(spec) != specHash(defaultSpec(defaultLabName, 2)) {
+		t.Errorf("specHash differs for identical specs")
+	}
+	if specHash(spec) == specHash(defaultSpec(defaultLabName, 3)) || specHash(spec) == specHash(defaultSpec("db", 2)) {
+		t.Errorf("specHash did not change with the node count or lab name")
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	defaultConnectTimeout = 5 * time.Second
+	defaultCommandTimeout = 10 * time.Second
+)
+
+// Reasons reported by SSHError
+const (
+	reasonRefused   = "connection refused"
+	reasonTimeout   = "timeout"
+	reasonAuth      = "auth failed"
+	reasonHandshake = "handshake failed"
+	reasonCommand   = "command failed"
+	reasonKey       = "bad key"
+)
+
+// SSHTarget identifies a lab node's SSH endpoint and the credentials to use
+type SSHTarget struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	KeyFile  string // private key, offered before the password when set
+}
+
+// Address returns the host:port to dial
+func (t SSHTarget) Address() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// SSHDialer runs commands on lab nodes over SSH
+type SSHDialer interface {
+	// Run executes command on target and returns its standard output
+	Run(ctx context.Context, target SSHTarget, command string) (string, error)
+
+	// Banner returns the identification line sshd sends on connect, without authenticating
+	Banner(ctx context.Context, target SSHTarget) (string, error)
+}
+
+// SSHError explains why a command could not be run on a node
+type SSHError struct {
+	Reason string // one of the reason constants
+	Err    error
+}
+
+func (e *SSHError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+}
+
+func (e *SSHError) Unwrap() error {
+	return e.Err
+}
+
+// sshReason returns the failure reason for err, or the error text when it is not an SSHError
+func sshReason(err error) string {
+	var sshErr *SSHError
+	if errors.As(err, &sshErr) {
+		return sshErr.Reason
+	}
+	return err.Error()
+}
+
+// nativeDialer runs commands with an in-process SSH client, so no ssh, sshpass
+// or timeout binaries are needed. Host keys are accepted on first use and
+// captured, keyed by address.
+type nativeDialer struct {
+	ConnectTimeout time.Duration // dial and handshake
+	CommandTimeout time.Duration // command execution once connected
+
+	mu       sync.Mutex
+	hostKeys map[string]ssh.PublicKey
+}
+
+var _ SSHDialer = (*nativeDialer)(nil)
+
+func newNativeDialer(connectTimeout, commandTimeout time.Duration) *nativeDialer {
+	if connectTimeout <= 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+	if commandTimeout <= 0 {
+		commandTimeout = defaultCommandTimeout
+	}
+	return &nativeDialer{ConnectTimeout: connectTimeout, CommandTimeout: commandTimeout, hostKeys: map[string]ssh.PublicKey{}}
+}
+
+// HostKey returns the host key captured for target, or nil before the first connection
+func (d *nativeDialer) HostKey(target SSHTarget) ssh.PublicKey {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.hostKeys[target.Address()]
+}
+
+func (d *nativeDialer) captureHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hostKeys[hostname] = key
+	return nil
+}
+
+// clientConfig builds the authentication settings for target
+func (d *nativeDialer) clientConfig(target SSHTarget) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if target.KeyFile != "" {
+		data, err := os.ReadFile(target.KeyFile)
+		if err != nil {
+			return nil, &SSHError{Reason: reasonKey, Err: err}
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, &SSHError{Reason: reasonKey, Err: fmt.Errorf("%s: %w", target.KeyFile, err)}
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if target.Password != "" {
+		password := target.Password
+		auth = append(auth, ssh.Password(password), ssh.KeyboardInteractive(
+			func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = password
+				}
+				return answers, nil
+			}))
+	}
+
+	return &ssh.ClientConfig{
+		User:            target.User,
+		Auth:            auth,
+		HostKeyCallback: d.captureHostKey,
+		Timeout:         d.ConnectTimeout,
+	}, nil
+}
+
+// Dial connects and authenticates to target
+func (d *nativeDialer) Dial(ctx context.Context, target SSHTarget) (*ssh.Client, error) {
+	config, err := d.clientConfig(target)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := net.Dialer{Timeout: d.ConnectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target.Address())
+	if err != nil {
+		return nil, classifySSHError(err)
+	}
+
+	// Bound the handshake as well, sshd may accept connections long before it answers
+	conn.SetDeadline(time.Now().Add(d.ConnectTimeout))
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, target.Address(), config)
+	if err != nil {
+		conn.Close()
+		return nil, classifySSHError(err)
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
+
+// Banner returns the identification line sshd sends on connect. A published
+// port accepts connections before sshd is listening, so only the banner shows
+// that the node is ready.
+func (d *nativeDialer) Banner(ctx context.Context, target SSHTarget) (string, error) {
+	dialer := net.Dialer{Timeout: d.ConnectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target.Address())
+	if err != nil {
+		return "", classifySSHError(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(d.ConnectTimeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", classifySSHError(err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "SSH-") {
+		return "", &SSHError{Reason: reasonHandshake, Err: fmt.Errorf("unexpected banner %q", line)}
+	}
+	return line, nil
+}
+
+// Run executes command on target and returns its standard output
+func (d *nativeDialer) Run(ctx context.Context, target SSHTarget, command string) (string, error) {
+	client, err := d.Dial(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", classifySSHError(err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+
+	timer := time.NewTimer(d.CommandTimeout)
+	defer timer.Stop()
+
+	// The output buffers are only read once the session has finished
+	select {
+	case err = <-done:
+	case <-timer.C:
+		client.Close()
+		return "", &SSHError{Reason: reasonTimeout, Err: fmt.Errorf("command did not finish within %s", d.CommandTimeout)}
+	case <-ctx.Done():
+		client.Close()
+		return "", ctx.Err()
+	}
+
+	output := strings.TrimRight(stdout.String(), "\n")
+	if err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			message := strings.TrimSpace(stderr.String())
+			if message == "" {
+				message = fmt.Sprintf("exit status %d", exitErr.ExitStatus())
+			} else {
+				message = fmt.Sprintf("exit status %d: %s", exitErr.ExitStatus(), message)
+			}
+			return output, &SSHError{Reason: reasonCommand, Err: errors.New(message)}
+		}
+		return output, &SSHError{Reason: reasonCommand, Err: err}
+	}
+	return output, nil
+}
+
+// ShellOptions describes an interactive session opened by Shell
+type ShellOptions struct {
+	Command string // run instead of the login shell when set
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+
+	// Term requests a PTY of that terminal type and Width x Height; empty runs without one
+	Term          string
+	Width, Height int
+	Resize        <-chan termSize // new terminal sizes while the session runs
+
+	// AgentSocket is the local SSH agent forwarded to the node, if any
+	AgentSocket string
+}
+
+// termSize is the size of a terminal in characters
+type termSize struct {
+	Width, Height int
+}
+
+// shellRunner is implemented by dialers that can open interactive sessions
+type shellRunner interface {
+	// Shell runs a session on target and returns its exit status
+	Shell(ctx context.Context, target SSHTarget, opts ShellOptions) (int, error)
+}
+
+var _ shellRunner = (*nativeDialer)(nil)
+
+// Shell runs an interactive session on target and returns its exit status
+func (d *nativeDialer) Shell(ctx context.Context, target SSHTarget, opts ShellOptions) (int, error) {
+	client, err := d.Dial(ctx, target)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, classifySSHError(err)
+	}
+	defer session.Close()
+
+	if opts.AgentSocket != "" {
+		if err := agent.ForwardToRemote(client, opts.AgentSocket); err != nil {
+			return 0, fmt.Errorf("agent forwarding: %w", err)
+		}
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return 0, fmt.Errorf("agent forwarding: %w", err)
+		}
+	}
+	if opts.Term != "" {
+		modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+		if err := session.RequestPty(opts.Term, opts.Height, opts.Width, modes); err != nil {
+			return 0, fmt.Errorf("failed to allocate a terminal: %w", err)
+		}
+	}
+	session.Stdin = opts.Stdin
+	session.Stdout = opts.Stdout
+	session.Stderr = opts.Stderr
+
+	if opts.Command != "" {
+		err = session.Start(opts.Command)
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		return 0, &SSHError{Reason: reasonCommand, Err: err}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	for {
+		select {
+		case size := <-opts.Resize:
+			session.WindowChange(size.Height, size.Width)
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case err := <-done:
+			var exitErr *ssh.ExitError
+			switch {
+			case err == nil:
+				return 0, nil
+			case errors.As(err, &exitErr):
+				return exitErr.ExitStatus(), nil
+			default:
+				return 0, &SSHError{Reason: reasonCommand, Err: err}
+			}
+		}
+	}
+}
+
+// classifySSHError maps dial and handshake errors to a failure reason
+func classifySSHError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return &SSHError{Reason: reasonRefused, Err: err}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return &SSHError{Reason: reasonTimeout, Err: err}
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		return &SSHError{Reason: reasonAuth, Err: err}
+	default:
+		return &SSHError{Reason: reasonHandshake, Err: err}
+	}
+}
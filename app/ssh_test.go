@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startTestSSHServer serves sessions on a random local port. Exec requests
+// run "echo X", which prints X, "sleep", and anything else exits with status 3. It accepts the password "secret"
+// and the returned client key.
+func startTestSSHServer(t *testing.T) (port int, hostKey ssh.PublicKey, clientKeyFile string) {
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostPriv)
+	clientPub, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	authorized, _ := ssh.NewPublicKey(clientPub)
+
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey: %v", err)
+	}
+	clientKeyFile = filepath.Join(t.TempDir(), "id_ed25519")
+	os.WriteFile(clientKeyFile, pem.EncodeToMemory(block), 0600)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSH(conn, config)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, hostSigner.PublicKey(), clientKeyFile
+}
+
+func serveTestSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		channel, channelRequests, _ := newChannel.Accept()
+		go serveTestSSHChannel(channel, channelRequests)
+	}
+}
+
+// serveTestSSHChannel handles a session. Shells report their PTY and every
+// window change, echo input lines as "> line" and end on "exit N".
+func serveTestSSHChannel(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	sendStatus := func(status uint32) {
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, status)
+		channel.SendRequest("exit-status", false, payload)
+	}
+
+	term, width, height := "none", uint32(0), uint32(0)
+	for request := range requests {
+		switch request.Type {
+		case "pty-req":
+			termLen := binary.BigEndian.Uint32(request.Payload)
+			term = string(request.Payload[4 : 4+termLen])
+			width = binary.BigEndian.Uint32(request.Payload[4+termLen:])
+			height = binary.BigEndian.Uint32(request.Payload[8+termLen:])
+			request.Reply(true, nil)
+		case "window-change":
+			fmt.Fprintf(channel, "resize %dx%d\n", binary.BigEndian.Uint32(request.Payload), binary.BigEndian.Uint32(request.Payload[4:]))
+		case "shell":
+			request.Reply(true, nil)
+			fmt.Fprintf(channel, "pty %s %dx%d\n", term, width, height)
+			go func() {
+				scanner := bufio.NewScanner(channel)
+				for scanner.Scan() {
+					if status, found := strings.CutPrefix(scanner.Text(), "exit "); found {
+						code, _ := strconv.Atoi(status)
+						sendStatus(uint32(code))
+						channel.Close()
+						return
+					}
+					fmt.Fprintf(channel, "> %s\n", scanner.Text())
+				}
+			}()
+		case "exec":
+			request.Reply(true, nil)
+			command := string(request.Payload[4:])
+			status := uint32(0)
+			switch {
+			case strings.HasPrefix(command, "echo "):
+				channel.Write([]byte(strings.TrimPrefix(command, "echo ") + "\n"))
+			case command == "sleep":
+				time.Sleep(time.Second)
+			default:
+				channel.Stderr().Write([]byte("no such command\n"))
+				status = 3
+			}
+			sendStatus(status)
+			return
+		default:
+			request.Reply(false, nil)
+		}
+	}
+}
+
+func TestNativeDialerRun(t *testing.T) {
+	port, hostKey, keyFile := startTestSSHServer(t)
+	dialer := newNativeDialer(time.Second, 200*time.Millisecond)
+	ctx := context.Background()
+
+	target := SSHTarget{Host: "127.0.0.1", Port: port, User: "labuser", Password: "secret"}
+	output, err := dialer.Run(ctx, target, "echo SSH_OK")
+	if err != nil || output != "SSH_OK" {
+		t.Fatalf("Run = %q, %v, expected SSH_OK", output, err)
+	}
+	if captured := dialer.HostKey(target); captured == nil || ssh.FingerprintSHA256(captured) != ssh.FingerprintSHA256(hostKey) {
+		t.Errorf("captured host key %v, expected %s", captured, ssh.FingerprintSHA256(hostKey))
+	}
+
+	keyTarget := SSHTarget{Host: "127.0.0.1", Port: port, User: "labuser", KeyFile: keyFile}
+	if output, err := dialer.Run(ctx, keyTarget, "echo KEY_OK"); err != nil || output != "KEY_OK" {
+		t.Errorf("Run with key = %q, %v, expected KEY_OK", output, err)
+	}
+}
+
+func TestNativeDialerFailureReasons(t *testing.T) {
+	port, _, _ := startTestSSHServer(t)
+
+	// A port that accepts connections but never speaks SSH
+	silent, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	// A port with nothing listening
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		target   SSHTarget
+		command  string
+		expected string
+	}{
+		{"refused", SSHTarget{Host: "127.0.0.1", Port: closedPort, User: "labuser", Password: "secret"}, "echo hi", reasonRefused},
+		{"handshake timeout", SSHTarget{Host: "127.0.0.1", Port: silent.Addr().(*net.TCPAddr).Port, User: "labuser", Password: "secret"}, "echo hi", reasonTimeout},
+		{"wrong password", SSHTarget{Host: "127.0.0.1", Port: port, User: "labuser", Password: "wrong"}, "echo hi", reasonAuth},
+		{"missing key", SSHTarget{Host: "127.0.0.1", Port: port, User: "labuser", KeyFile: "/nonexistent/key"}, "echo hi", reasonKey},
+		{"command failed", SSHTarget{Host: "127.0.0.1", Port: port, User: "labuser", Password: "secret"}, "fail", reasonCommand},
+		{"command timeout", SSHTarget{Host: "127.0.0.1", Port: port, User: "labuser", Password: "secret"}, "sleep", reasonTimeout},
+	}
+
+	dialer := newNativeDialer(300*time.Millisecond, 200*time.Millisecond)
+	for _, test := range tests {
+		_, err := dialer.Run(context.Background(), test.target, test.command)
+		if err == nil {
+			t.Errorf("%s: Run expected error, got nil", test.name)
+			continue
+		}
+		if reason := sshReason(err); reason != test.expected {
+			t.Errorf("%s: reason = %q (%v), expected %q", test.name, reason, err, test.expected)
+		}
+	}
+
+	_, err := dialer.Run(context.Background(), tests[4].target, "fail")
+	if err == nil || !strings.Contains(err.Error(), "exit status 3: no such command") {
+		t.Errorf("command failure error = %v, expected exit status and stderr", err)
+	}
+}
+
+func TestNativeDialerBanner(t *testing.T) {
+	port, _, _ := startTestSSHServer(t)
+
+	// A port that accepts connections and closes them, like a published port before sshd is up
+	closing, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer closing.Close()
+	go func() {
+		for {
+			conn, err := closing.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	dialer := newNativeDialer(300*time.Millisecond, 200*time.Millisecond)
+	banner, err := dialer.Banner(context.Background(), SSHTarget{Host: "127.0.0.1", Port: port})
+	if err != nil || !strings.HasPrefix(banner, "SSH-2.0-") {
+		t.Errorf("Banner = %q, %v, expected an SSH-2.0 identification line", banner, err)
+	}
+
+	_, err = dialer.Banner(context.Background(), SSHTarget{Host: "127.0.0.1", Port: closing.Addr().(*net.TCPAddr).Port})
+	if err == nil || sshReason(err) != reasonHandshake {
+		t.Errorf("Banner on a closing port = %v, expected %q", err, reasonHandshake)
+	}
+}
+
+// waitForOutput polls buf until it contains text
+func waitForOutput(t *testing.T, buf *lockedBuffer, text string) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if strings.Contains(buf.String(), text) {
+			return
+		}
+	}
+	t.Fatalf("output never contained %q:\n%s", text, buf.String())
+}
+
+func TestNativeDialerShell(t *testing.T) {
+	port, _, _ := startTestSSHServer(t)
+	dialer := newNativeDialer(time.Second, time.Second)
+
+	stdin, input := io.Pipe()
+	stdout := &lockedBuffer{}
+	resize := make(chan termSize)
+	status := make(chan int, 1)
+	go func() {
+		code, err := dialer.Shell(context.Background(), SSHTarget{Host: "127.0.0.1", Port: port, User: "root", Password: "secret"},
+			ShellOptions{Stdin: stdin, Stdout: stdout, Stderr: stdout, Term: "xterm", Width: 80, Height: 24, Resize: resize})
+		if err != nil {
+			t.Errorf("Shell unexpected error: %v", err)
+		}
+		status <- code
+	}()
+
+	waitForOutput(t, stdout, "pty xterm 80x24")
+	io.WriteString(input, "hello\n")
+	waitForOutput(t, stdout, "> hello")
+	resize <- termSize{Width: 120, Height: 40}
+	waitForOutput(t, stdout, "resize 120x40")
+	io.WriteString(input, "exit 5\n")
+
+	select {
+	case code := <-status:
+		if code != 5 {
+			t.Errorf("Shell exit status = %d, expected 5", code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Shell did not return after the remote shell exited")
+	}
+}
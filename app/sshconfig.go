@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Files ssh-config writes to the lab's state directory
+const (
+	sshConfigFile  = "ssh_config"
+	knownHostsFile = "known_hosts"
+)
+
+// sshConfigValue quotes a path for ssh_config when it contains spaces
+func sshConfigValue(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// writeSSHConfig writes a Host block per running node to path, the lab's
+// ssh_config when empty, so plain ssh, scp and rsync reach the nodes by name.
+// The host keys of the nodes go to the lab's own known_hosts file, which is
+// rewritten every time so re-created nodes do not trip host key checking.
+func (a *App) writeSSHConfig(ctx context.Context, spec *LabSpec, path string) error {
+	if a.StateDir == "" {
+		return errors.New("ssh-config needs a state directory for the lab's known_hosts file")
+	}
+	dir := a.labDir(spec.Name)
+	if path == "" {
+		path = filepath.Join(dir, sshConfigFile)
+	}
+	knownHosts := filepath.Join(dir, knownHostsFile)
+
+	w := a.errOut()
+	fmt.Fprintf(w, "\n%s %s\n", cyan("🔐"), bold("Generating SSH Config"))
+	fmt.Fprintf(w, "%s\n", blue("═══════════════════════════════════"))
+
+	containers, err := a.getContainers(ctx, spec)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return errNoContainers
+	}
+
+	var config, keys strings.Builder
+	fmt.Fprintf(&config, "# LAB SSH config for lab %s (Generated)\n", spec.Name)
+	if path != "-" {
+		fmt.Fprintf(&config, "# Use it from ~/.ssh/config, before any Host block: Include %s\n", path)
+	}
+	fmt.Fprintf(&keys, "# LAB known hosts for lab %s (Generated)\n", spec.Name)
+
+	recorder, _ := a.SSH.(hostKeyRecorder)
+	var first string
+	for _, container := range containers {
+		port := spec.containerSSHPort(container)
+		if !container.Running() || port == 0 {
+			continue
+		}
+		node := spec.nodeName(container)
+		if first == "" {
+			first = node
+		}
+		target := a.sshTarget(spec, port)
+
+		aliases := node
+		if container.Name != node {
+			aliases += " " + container.Name
+		}
+		fmt.Fprintf(&config, "\nHost %s\n", aliases)
+		fmt.Fprintf(&config, "  HostName %s\n", target.Host)
+		fmt.Fprintf(&config, "  Port %d\n", port)
+		fmt.Fprintf(&config, "  User %s\n", target.User)
+		if target.KeyFile != "" {
+			fmt.Fprintf(&config, "  IdentityFile %s\n", sshConfigValue(target.KeyFile))
+			fmt.Fprintf(&config, "  IdentitiesOnly yes\n")
+		}
+		// Nodes share localhost, so their keys are stored under the node name
+		fmt.Fprintf(&config, "  HostKeyAlias %s\n", node)
+		fmt.Fprintf(&config, "  UserKnownHostsFile %s\n", sshConfigValue(knownHosts))
+		fmt.Fprintf(&config, "  StrictHostKeyChecking accept-new\n")
+
+		// The host key is captured during the handshake, before authentication
+		if recorder == nil {
+			continue
+		}
+		_, err := a.SSH.Run(ctx, target, "true")
+		if key := recorder.HostKey(target); key != nil {
+			fmt.Fprintf(&keys, "%s\n", knownhosts.Line([]string{node}, key))
+		} else {
+			fmt.Fprintf(w, "%s Could not read the host key of %s: %v\n", yellow("⚠️"), node, err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create lab directory: %w", err)
+	}
+	if err := writeFileAtomic(knownHosts, []byte(keys.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	if path == "-" {
+		_, err := fmt.Fprint(a.Out, config.String())
+		return err
+	}
+	if err := writeFileAtomic(path, []byte(config.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write SSH config: %w", err)
+	}
+
+	fmt.Fprintf(w, "%s SSH config generated: %s\n", green("✅"), bold(path))
+	fmt.Fprintf(w, "%s Host keys recorded in %s\n", green("🔑"), knownHosts)
+	fmt.Fprintf(w, "\n%s\n", bold("Add it to ~/.ssh/config, before any Host block:"))
+	fmt.Fprintf(w, "  Include %s\n", path)
+	if first != "" {
+		fmt.Fprintf(w, "\n%s\n", bold("Then connect by node name:"))
+		fmt.Fprintf(w, "  %s ssh %s\n", cyan("$"), first)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
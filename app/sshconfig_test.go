@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// hostKeyDialer is a fakeDialer that captures host keys, keyed by port
+type hostKeyDialer struct {
+	*fakeDialer
+	keys map[int]ssh.PublicKey
+}
+
+func (d *hostKeyDialer) HostKey(target SSHTarget) ssh.PublicKey {
+	return d.keys[target.Port]
+}
+
+func TestWriteSSHConfig(t *testing.T) {
+	app, rt, dialer, out := newTestApp()
+	app.StateDir = t.TempDir()
+	public, _, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewPublicKey(public)
+	app.SSH = &hostKeyDialer{fakeDialer: dialer, keys: map[int]ssh.PublicKey{2222: hostKey}}
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	rt.addContainer(defaultLabName, "lab-02", "running", 2223)
+	rt.addContainer(defaultLabName, "lab-03", "exited", 2224)
+	spec := defaultSpec(defaultLabName, 3)
+	spec.keyFile = "/home/me/lab keys/id_ed25519"
+
+	if err := app.writeSSHConfig(context.Background(), spec, ""); err != nil {
+		t.Fatalf("writeSSHConfig unexpected error: %v", err)
+	}
+
+	dir := app.labDir(defaultLabName)
+	config, err := os.ReadFile(filepath.Join(dir, sshConfigFile))
+	if err != nil {
+		t.Fatalf("ssh_config not written: %v", err)
+	}
+	knownHostsPath := filepath.Join(dir, knownHostsFile)
+	for _, expected := range []string{
+		"\nHost lab-01\n  HostName localhost\n  Port 2222\n  User " + defaultUser + "\n",
+		"  IdentityFile \"/home/me/lab keys/id_ed25519\"\n  IdentitiesOnly yes\n",
+		"  HostKeyAlias lab-02\n  UserKnownHostsFile " + knownHostsPath + "\n",
+		"Include " + filepath.Join(dir, sshConfigFile),
+	} {
+		if !strings.Contains(string(config), expected) {
+			t.Errorf("ssh_config missing %q:\n%s", expected, config)
+		}
+	}
+	if strings.Contains(string(config), "lab-03") {
+		t.Errorf("ssh_config should only cover running nodes:\n%s", config)
+	}
+
+	// ssh looks the key up under the HostKeyAlias
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		t.Fatalf("known_hosts does not parse: %v", err)
+	}
+	if err := callback("lab-01:22", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}, hostKey); err != nil {
+		t.Errorf("known_hosts should accept the host key of lab-01: %v", err)
+	}
+	if !strings.Contains(out.String(), "Could not read the host key of lab-02") {
+		t.Errorf("expected a warning for the node without a host key, got:\n%s", out)
+	}
+}
+
+func TestWriteSSHConfigStdout(t *testing.T) {
+	app, rt, _, out := newTestApp()
+	app.StateDir = t.TempDir()
+	rt.addContainer(defaultLabName, "lab-01", "running", 2222)
+	spec := defaultSpec(defaultLabName, 1)
+
+	if err := app.writeSSHConfig(context.Background(), spec, "-"); err != nil {
+		t.Fatalf("writeSSHConfig unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Host lab-01\n") || strings.Contains(out.String(), "IdentityFile") {
+		t.Errorf("expected a Host block without a key for a lab without one, got:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(app.labDir(defaultLabName), knownHostsFile)); err != nil {
+		t.Errorf("known_hosts should be written also when the config goes to stdout: %v", err)
+	}
+}
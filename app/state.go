@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateFile is the name of the state file kept in each lab's state directory
+const stateFile = "state.json"
+
+// LabState is what the tool remembers about a lab between invocations
+type LabState struct {
+	Lab         string               `json:"lab"`
+	Created     time.Time            `json:"created"`
+	Updated     time.Time            `json:"updated"`
+	SpecHash    string               `json:"spec_hash"`
+	Credentials Credentials          `json:"credentials"`
+	Images      map[string]string    `json:"images"` // image reference -> image ID
+	Nodes       map[string]NodeState `json:"nodes"`
+
+	// Groups holds the groups given to init with --group for a lab without a spec file
+	Groups map[string]GroupSpec `json:"groups,omitempty"`
+}
+
+// Credentials are the accounts configured inside every node
+type Credentials struct {
+	User         string `json:"user"`
+	Password     string `json:"password"`
+	RootPassword string `json:"root_password"`
+}
+
+// NodeState records the container created for a node
+type NodeState struct {
+	Container   string `json:"container"`
+	ContainerID string `json:"container_id"`
+	SSHPort     int    `json:"ssh_port"`
+}
+
+// ports returns the SSH host port of every node
+func (s *LabState) ports() map[string]int {
+	ports := map[string]int{}
+	for name, node := range s.Nodes {
+		if node.SSHPort != 0 {
+			ports[name] = node.SSHPort
+		}
+	}
+	return ports
+}
+
+// defaultStateDir returns $LAB_HOME, or ~/.lab
+func defaultStateDir() string {
+	if dir := os.Getenv("LAB_HOME"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".lab"
+	}
+	return filepath.Join(home, ".lab")
+}
+
+// labDir returns the directory holding the state of lab
+func (a *App) labDir(lab string) string {
+	return filepath.Join(a.StateDir, lab)
+}
+
+// loadState reads the state of lab, returning an empty state when none was saved
+func (a *App) loadState(lab string) (*LabState, error) {
+	state := &LabState{Lab: lab, Images: map[string]string{}, Nodes: map[string]NodeState{}}
+	if a.StateDir == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(a.labDir(lab), stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state of lab %s: %w", lab, err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("state of lab %s is corrupt: %w", lab, err)
+	}
+	if state.Images == nil {
+		state.Images = map[string]string{}
+	}
+	if state.Nodes == nil {
+		state.Nodes = map[string]NodeState{}
+	}
+	return state, nil
+}
+
+// saveState replaces the state of a lab atomically, so readers never see a
+// partly written file
+func (a *App) saveState(state *LabState) error {
+	if a.StateDir == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := a.labDir(state.Lab)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to save state of lab %s: %w", state.Lab, err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, stateFile), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to save state of lab %s: %w", state.Lab, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeState forgets a lab once all its resources are gone
+func (a *App) removeState(lab string) error {
+	if a.StateDir == "" {
+		return nil
+	}
+	for _, file := range []string{stateFile, labKeyFile, labKeyFile + ".pub", sshConfigFile, knownHostsFile} {
+		err := os.Remove(filepath.Join(a.labDir(lab), file))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	// The directory may hold other files, such as the lock
+	os.Remove(a.labDir(lab))
+	return nil
+}
+
+// applyState loads the ports, credentials, groups and SSH key recorded for the spec's lab
+func (a *App) applyState(spec *LabSpec) error {
+	state, err := a.loadState(spec.Name)
+	if err != nil {
+		return err
+	}
+	spec.ports = state.ports()
+	if spec.source == "" && spec.Groups == nil {
+		spec.Groups = state.Groups
+	}
+	applyCredentials(spec, state)
+	return a.loadLabKey(spec)
+}
+
+// recordState saves the nodes, ports, credentials and images of a lab after
+// createLab, keeping the creation time of a lab that was recorded before
+func (a *App) recordState(ctx context.Context, spec *LabSpec) error {
+	state, err := a.loadState(spec.Name)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if state.Created.IsZero() {
+		state.Created = now
+	}
+	state.Updated = now
+	state.SpecHash = specHash(spec)
+	state.Credentials = Credentials{User: spec.User.Name, Password: spec.User.Password, RootPassword: spec.User.RootPassword}
+	state.Groups = nil
+	if spec.source == "" {
+		state.Groups = spec.Groups
+	}
+
+	containers, err := a.Runtime.ListContainers(ctx, ListOptions{All: true, Labels: roleLabels(spec, roleNode)})
+	if err != nil {
+		return err
+	}
+	ids := map[string]string{}
+	for _, container := range containers {
+		ids[container.Name] = container.ID
+	}
+
+	state.Images = map[string]string{}
+	state.Nodes = map[string]NodeState{}
+	for _, node := range spec.Nodes {
+		config := nodeContainerConfig(spec, node)
+		state.Nodes[node.Name] = NodeState{Container: config.Name, ContainerID: ids[config.Name], SSHPort: spec.sshPort(node)}
+		if _, seen := state.Images[config.Image]; !seen {
+			id, err := a.Runtime.ImageID(ctx, config.Image)
+			if err != nil {
+				return fmt.Errorf("failed to inspect image %s: %w", config.Image, err)
+			}
+			state.Images[config.Image] = id
+		}
+	}
+	return a.saveState(state)
+}
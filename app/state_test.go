@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordState(t *testing.T) {
+	app, _, _, _ := newTestApp()
+	app.StateDir = t.TempDir()
+	spec := defaultSpec("db", 2)
+
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("initLab unexpected error: %v", err)
+	}
+	state, err := app.loadState("db")
+	if err != nil {
+		t.Fatalf("loadState unexpected error: %v", err)
+	}
+	if state.Created.IsZero() || state.SpecHash != specHash(spec) || state.Credentials.User != defaultUser || state.Credentials.Password != spec.User.Password {
+		t.Errorf("state = %+v, expected creation time, spec hash and credentials", state)
+	}
+	if node := state.Nodes["db-02"]; node.Container != "db-02" || node.ContainerID == "" || node.SSHPort != 2223 {
+		t.Errorf("state node db-02 = %+v, expected container, ID and port", node)
+	}
+	if id := state.Images[defaultImage]; !strings.HasPrefix(id, "sha256:") {
+		t.Errorf("state images = %v, expected the ID of %s", state.Images, defaultImage)
+	}
+
+	info, err := os.Stat(filepath.Join(app.StateDir, "db", stateFile))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("state file mode = %v, %v, expected 0600", info, err)
+	}
+
+	// Re-initializing keeps the creation time
+	created := state.Created
+	app.stopLab(context.Background(), spec)
+	if err := app.initLab(context.Background(), spec); err != nil {
+		t.Fatalf("second initLab unexpected error: %v", err)
+	}
+	if state, _ := app.loadState("db"); !state.Created.Equal(created) {
+		t.Errorf("created = %v after re-init, expected %v", state.Created, created)
+	}
+}
+
+func TestSaveStateIsAtomic(t *testing.T) {
+	app := &App{StateDir: t.TempDir()}
+	for i := 0; i < 3; i++ {
+		if err := app.saveState(&LabState{Lab: "db", Nodes: map[string]NodeState{"db-01": {SSHPort: 2222 + i}}}); err != nil {
+			t.Fatalf("saveState unexpected error: %v", err)
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(app.StateDir, "db"))
+	if len(entries) != 1 || entries[0].Name() != stateFile {
+		t.Errorf("state directory = %v, expected only %s", entries, stateFile)
+	}
+	if state, err := app.loadState("db"); err != nil || state.Nodes["db-01"].SSHPort != 2224 {
+		t.Errorf("loadState = %+v, %v, expected the last write", state, err)
+	}
+
+	os.WriteFile(filepath.Join(app.StateDir, "db", stateFile), []byte("{"), 0600)
+	if _, err := app.loadState("db"); err == nil || !strings.Contains(err.Error(), "state of lab db is corrupt") {
+		t.Errorf("loadState error = %v, expected a corrupt state error", err)
+	}
+}
+
+func TestLockLabFailsFast(t *testing.T) {
+	dir := t.TempDir()
+	first := &App{StateDir: dir, Out: &bytes.Buffer{}}
+	unlock, err := first.lockLab(context.Background(), "db", "init", 0)
+	if err != nil {
+		t.Fatalf("lockLab unexpected error: %v", err)
+	}
+
+	second := &App{StateDir: dir, Out: &bytes.Buffer{}}
+	_, err = second.lockLab(context.Background(), "db", "clean", 0)
+	if err == nil || !strings.Contains(err.Error(), "lab db is busy (pid") || !strings.Contains(err.Error(), ": init)") {
+		t.Errorf("lockLab error = %v, expected the lab to be busy with init", err)
+	}
+
+	// Other labs are not affected
+	unlockOther, err := second.lockLab(context.Background(), "web", "init", 0)
+	if err != nil {
+		t.Errorf("lockLab(web) unexpected error: %v", err)
+	} else {
+		unlockOther()
+	}
+
+	unlock()
+	unlock, err = second.lockLab(context.Background(), "db", "clean", 0)
+	if err != nil {
+		t.Fatalf("lockLab after release unexpected error: %v", err)
+	}
+	unlock()
+}
+
+func TestLockLabWaits(t *testing.T) {
+	interval := lockPollInterval
+	lockPollInterval = 5 * time.Millisecond
+	t.Cleanup(func() { lockPollInterval = interval })
+
+	dir := t.TempDir()
+	unlock, err := (&App{StateDir: dir, Out: &bytes.Buffer{}}).lockLab(context.Background(), "db", "init", 0)
+	if err != nil {
+		t.Fatalf("lockLab unexpected error: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	var wg sync.WaitGroup
+	var waitErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		release, err := (&App{StateDir: dir, Out: out}).lockLab(context.Background(), "db", "stop", time.Second)
+		waitErr = err
+		if err == nil {
+			release()
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	unlock()
+	wg.Wait()
+
+	if waitErr != nil {
+		t.Errorf("waiting lockLab unexpected error: %v", waitErr)
+	}
+	if !strings.Contains(out.String(), "Waiting for another command on lab db to finish") {
+		t.Errorf("output should say the command is waiting:\n%s", out.String())
+	}
+}
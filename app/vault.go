@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Ansible vault 1.1 with the AES256 cipher: PBKDF2-SHA256 derives an AES-256
+// key, an HMAC-SHA256 key and the CTR counter from the password and a random salt
+const (
+	vaultHeader     = "$ANSIBLE_VAULT;1.1;AES256"
+	vaultSaltSize   = 32
+	vaultKeySize    = 32
+	vaultIterations = 10000
+	vaultLineWidth  = 80
+)
+
+// readVaultPassword reads the password from a vault password file. Like
+// Ansible, an executable file is run and its output used as the password.
+func readVaultPassword(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("vault password file: %w", err)
+	}
+
+	var data []byte
+	if info.Mode()&0111 != 0 {
+		cmd := exec.Command(path)
+		cmd.Stderr = os.Stderr
+		if data, err = cmd.Output(); err != nil {
+			return nil, fmt.Errorf("vault password script %s: %w", path, err)
+		}
+	} else if data, err = os.ReadFile(path); err != nil {
+		return nil, fmt.Errorf("vault password file: %w", err)
+	}
+
+	password := bytes.TrimSpace(data)
+	if len(password) == 0 {
+		return nil, fmt.Errorf("vault password file %s is empty", path)
+	}
+	return password, nil
+}
+
+// vaultKeys derives the cipher key, HMAC key and initial counter from password and salt
+func vaultKeys(password, salt []byte) (cipherKey, hmacKey, iv []byte) {
+	derived := pbkdf2.Key(password, salt, vaultIterations, 2*vaultKeySize+aes.BlockSize, sha256.New)
+	return derived[:vaultKeySize], derived[vaultKeySize : 2*vaultKeySize], derived[2*vaultKeySize:]
+}
+
+// vaultEncrypt encrypts plaintext in the format of `ansible-vault encrypt_string`
+func vaultEncrypt(plaintext, password []byte) (string, error) {
+	salt := make([]byte, vaultSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return vaultEncryptWithSalt(plaintext, password, salt)
+}
+
+// vaultEncryptWithSalt encrypts plaintext with a given salt, which makes the
+// vault reproducible
+func vaultEncryptWithSalt(plaintext, password, salt []byte) (string, error) {
+	cipherKey, hmacKey, iv := vaultKeys(password, salt)
+
+	// Ansible pads with PKCS#7 even though CTR mode does not need it
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte(nil), plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	block, err := aes.NewCipher(cipherKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, padded)
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(ciphertext)
+
+	body := hex.EncodeToString(salt) + "\n" + hex.EncodeToString(mac.Sum(nil)) + "\n" + hex.EncodeToString(ciphertext)
+	encoded := hex.EncodeToString([]byte(body))
+
+	lines := []string{vaultHeader}
+	for len(encoded) > vaultLineWidth {
+		lines = append(lines, encoded[:vaultLineWidth])
+		encoded = encoded[vaultLineWidth:]
+	}
+	lines = append(lines, encoded)
+	return strings.Join(lines, "\n"), nil
+}
+
+// vaultDecrypt reverses vaultEncrypt, checking the HMAC before decrypting
+func vaultDecrypt(vaulted string, password []byte) ([]byte, error) {
+	lines := strings.Split(strings.TrimSpace(vaulted), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(strings.TrimSpace(lines[0]), vaultHeader) {
+		return nil, errors.New("not an AES256 ansible vault")
+	}
+	var encoded strings.Builder
+	for _, line := range lines[1:] {
+		encoded.WriteString(strings.TrimSpace(line))
+	}
+	body, err := hex.DecodeString(encoded.String())
+	if err != nil {
+		return nil, fmt.Errorf("malformed vault: %w", err)
+	}
+	parts := strings.Split(string(body), "\n")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed vault: expected salt, HMAC and ciphertext")
+	}
+	var fields [3][]byte
+	for i, part := range parts {
+		if fields[i], err = hex.DecodeString(part); err != nil {
+			return nil, fmt.Errorf("malformed vault: %w", err)
+		}
+	}
+	salt, sum, ciphertext := fields[0], fields[1], fields[2]
+
+	cipherKey, hmacKey, iv := vaultKeys(password, salt)
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(ciphertext)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return nil, errors.New("vault HMAC mismatch - wrong vault password?")
+	}
+
+	block, err := aes.NewCipher(cipherKey)
+	if err != nil {
+		return nil, err
+	}
+	padded := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(padded, ciphertext)
+	if len(padded) == 0 || int(padded[len(padded)-1]) > aes.BlockSize || int(padded[len(padded)-1]) > len(padded) {
+		return nil, errors.New("malformed vault: bad padding")
+	}
+	return padded[:len(padded)-int(padded[len(padded)-1])], nil
+}
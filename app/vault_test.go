@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	password := []byte("correct horse")
+	for _, plaintext := range []string{"", "labpass123", "exactly 16 bytes", strings.Repeat("x", 100)} {
+		vaulted, err := vaultEncrypt([]byte(plaintext), password)
+		if err != nil {
+			t.Fatalf("vaultEncrypt unexpected error: %v", err)
+		}
+
+		lines := strings.Split(vaulted, "\n")
+		if lines[0] != vaultHeader {
+			t.Errorf("header = %q, expected %q", lines[0], vaultHeader)
+		}
+		for _, line := range lines[1:] {
+			if len(line) > vaultLineWidth || strings.Trim(line, "0123456789abcdef") != "" {
+				t.Errorf("body line %q should be at most %d hex characters", line, vaultLineWidth)
+			}
+		}
+
+		decrypted, err := vaultDecrypt(vaulted, password)
+		if err != nil || string(decrypted) != plaintext {
+			t.Errorf("vaultDecrypt = %q, %v; expected %q", decrypted, err, plaintext)
+		}
+		if _, err := vaultDecrypt(vaulted, []byte("wrong")); err == nil || !strings.Contains(err.Error(), "HMAC") {
+			t.Errorf("vaultDecrypt with the wrong password error = %v, expected an HMAC mismatch", err)
+		}
+	}
+}
+
+// ansibleVault was written by Ansible's own vault, with the password
+// test-vault-password, for the plaintext Setec Astronomy
+const ansibleVault = `$ANSIBLE_VAULT;1.1;AES256
+33363965326261303234626463623963633531343539616138316433353830356566396130353436
+3562643163366231316662386565383735653432386435610a306664636137376132643732393835
+63383038383730306639353234326630666539346233376330303938323639306661313032396437
+6233623062366136310a633866373936313238333730653739323461656662303864663666653563
+3138`
+
+func TestVaultMatchesAnsible(t *testing.T) {
+	password := []byte("test-vault-password")
+	plaintext, err := vaultDecrypt(ansibleVault, password)
+	if err != nil || string(plaintext) != "Setec Astronomy" {
+		t.Fatalf("vaultDecrypt = %q, %v; expected Setec Astronomy", plaintext, err)
+	}
+
+	// With Ansible's salt the vault must come out byte for byte the same
+	body, _ := hex.DecodeString(strings.Join(strings.Split(ansibleVault, "\n")[1:], ""))
+	salt, _ := hex.DecodeString(strings.Split(string(body), "\n")[0])
+	vaulted, err := vaultEncryptWithSalt(plaintext, password, salt)
+	if err != nil {
+		t.Fatalf("vaultEncryptWithSalt unexpected error: %v", err)
+	}
+	if vaulted != ansibleVault {
+		t.Errorf("vaultEncryptWithSalt =\n%s\nexpected Ansible's\n%s", vaulted, ansibleVault)
+	}
+}
+
+func TestInventoryWithVault(t *testing.T) {
+	spec := defaultSpec(defaultLabName, 1)
+	containers := []Container{{Name: "lab-01", State: "running", Labels: map[string]string{labNodeLabel: "lab-01"},
+		Ports: []PortBinding{{HostPort: 2222, ContainerPort: 22, Protocol: "tcp"}}}}
+	password := []byte("vault-secret")
+
+	content, err := generateInventoryContent(spec, containers, password)
+	if err != nil {
+		t.Fatalf("generateInventoryContent unexpected error: %v", err)
+	}
+	if strings.Contains(content, spec.User.Password) || strings.Contains(content, spec.User.RootPassword) {
+		t.Fatalf("inventory contains a cleartext password:\n%s", content)
+	}
+
+	var inventory yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &inventory); err != nil {
+		t.Fatalf("inventory is not valid YAML: %v\n%s", err, content)
+	}
+	secrets := map[string]*yaml.Node{}
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		for i := 0; i+1 < len(node.Content); i++ {
+			if node.Kind == yaml.MappingNode && i%2 == 0 {
+				secrets[node.Content[i].Value] = node.Content[i+1]
+			}
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(&inventory)
+
+	for key, expected := range map[string]string{
+		"ansible_ssh_pass":  spec.User.Password,
+		"lab_user_password": spec.User.Password,
+		"lab_root_password": spec.User.RootPassword,
+	} {
+		node := secrets[key]
+		if node == nil || node.Tag != "!vault" {
+			t.Errorf("%s = %+v, expected a !vault value", key, node)
+			continue
+		}
+		if plaintext, err := vaultDecrypt(node.Value, password); err != nil || string(plaintext) != expected {
+			t.Errorf("%s decrypts to %q, %v; expected %q", key, plaintext, err, expected)
+		}
+	}
+	if node := secrets["ansible_user"]; node == nil || node.Value != defaultUser || node.Tag == "!vault" {
+		t.Errorf("ansible_user = %+v, expected it to stay plain", node)
+	}
+}
+
+func TestReadVaultPassword(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "vault-pass")
+	os.WriteFile(file, []byte("s3cret\n"), 0600)
+	if password, err := readVaultPassword(file); err != nil || string(password) != "s3cret" {
+		t.Errorf("readVaultPassword(file) = %q, %v; expected s3cret", password, err)
+	}
+
+	script := filepath.Join(dir, "vault-pass.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\necho from-script\n"), 0700)
+	if password, err := readVaultPassword(script); err != nil || string(password) != "from-script" {
+		t.Errorf("readVaultPassword(script) = %q, %v; expected from-script", password, err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	os.WriteFile(empty, []byte("\n"), 0600)
+	if _, err := readVaultPassword(empty); err == nil {
+		t.Errorf("readVaultPassword should reject an empty password")
+	}
+}
@@ -28,16 +28,30 @@ log_env_var "ROOT_PASSWORD" "$ROOT_PASSWORD" "true"
 log_env_var "USER" "$USER" "false"
 log_env_var "USER_PASSWORD" "$USER_PASSWORD" "true"
 log_env_var "SUDO" "$SUDO" "false"
+log_env_var "PASSWORD_AUTH" "$PASSWORD_AUTH" "false"
+log_env_var "AUTHORIZED_KEY" "$AUTHORIZED_KEY" "false"
 
 echo ""
 echo "🔧 Container Configuration:"
 
+# Passwords given in the environment are only set on the first boot, so
+# passwords rotated with `lab credentials --rotate` survive restarts. The lab
+# tool leaves them out of the environment and sets them with chpasswd once
+# this script has run.
+CONFIGURED_MARKER=/var/lib/lab/configured
+FIRST_BOOT=true
+if [ -f "$CONFIGURED_MARKER" ]; then
+    FIRST_BOOT=false
+fi
+
 # 1. Configure root password
-if [ -n "$ROOT_PASSWORD" ]; then
+if [ -n "$ROOT_PASSWORD" ] && [ "$FIRST_BOOT" = "false" ]; then
+    echo "ℹ️  Root password already configured"
+elif [ -n "$ROOT_PASSWORD" ]; then
     echo "root:$ROOT_PASSWORD" | chpasswd
     echo "✅ Root password configured"
 else
-    echo "⚠️  No root password set - root login disabled"
+    echo "ℹ️  No root password in the environment"
 fi
 
 # 2. Create user if specified
@@ -54,11 +68,13 @@ if [ -n "$USER" ]; then
     fi
     
     # Set user password if provided
-    if [ -n "$USER_PASSWORD" ]; then
+    if [ -n "$USER_PASSWORD" ] && [ "$FIRST_BOOT" = "false" ]; then
+        echo "ℹ️  Password for user $USER already configured"
+    elif [ -n "$USER_PASSWORD" ]; then
         echo "$USER:$USER_PASSWORD" | chpasswd
         echo "✅ Password set for user $USER"
     else
-        echo "⚠️  No password set for user $USER"
+        echo "ℹ️  No password for user $USER in the environment"
     fi
     
     # Add to sudo group if SUDO is true
@@ -77,7 +93,31 @@ else
     echo "ℹ️  No additional user specified"
 fi
 
-# 3. Generate SSH host keys if they don't exist
+# 3. Install the lab's public key for root and the user
+install_authorized_key() {
+    local account="$1"
+    local home
+    home=$(getent passwd "$account" | cut -d: -f6)
+    mkdir -p "$home/.ssh"
+    chmod 700 "$home/.ssh"
+    if ! grep -qxF "$AUTHORIZED_KEY" "$home/.ssh/authorized_keys" 2>/dev/null; then
+        echo "$AUTHORIZED_KEY" >> "$home/.ssh/authorized_keys"
+    fi
+    chmod 600 "$home/.ssh/authorized_keys"
+    chown -R "$account:" "$home/.ssh"
+    echo "✅ Lab SSH key authorized for $account"
+}
+
+if [ -n "$AUTHORIZED_KEY" ]; then
+    install_authorized_key root
+    if [ -n "$USER" ]; then
+        install_authorized_key "$USER"
+    fi
+else
+    echo "ℹ️  No lab SSH key given - password login only"
+fi
+
+# 4. Generate SSH host keys if they don't exist
 if [ ! -f /etc/ssh/ssh_host_rsa_key ]; then
     echo "🔑 Generating SSH host keys..."
     ssh-keygen -A
@@ -86,23 +126,33 @@ else
     echo "ℹ️  SSH host keys already exist"
 fi
 
-# 4. Configure SSH daemon
+# 5. Configure SSH daemon
 echo "🌐 Configuring SSH daemon..."
 
-# Allow root login if root password is set
-if [ -n "$ROOT_PASSWORD" ]; then
-    sed -i 's/#PermitRootLogin prohibit-password/PermitRootLogin yes/' /etc/ssh/sshd_config
-    sed -i 's/PermitRootLogin prohibit-password/PermitRootLogin yes/' /etc/ssh/sshd_config
+# Allow root login with the root password, or with the lab key only. Without
+# a password root's account stays locked, so a password login needs one set.
+sed -i 's/^#\?PermitRootLogin .*/PermitRootLogin no/' /etc/ssh/sshd_config
+if [ "$PASSWORD_AUTH" != "false" ]; then
+    sed -i 's/^PermitRootLogin .*/PermitRootLogin yes/' /etc/ssh/sshd_config
     echo "✅ Root SSH login enabled"
+elif [ -n "$AUTHORIZED_KEY" ]; then
+    sed -i 's/^PermitRootLogin .*/PermitRootLogin prohibit-password/' /etc/ssh/sshd_config
+    echo "✅ Root SSH login enabled with the lab key only"
 else
-    sed -i 's/#PermitRootLogin prohibit-password/PermitRootLogin no/' /etc/ssh/sshd_config
-    sed -i 's/PermitRootLogin yes/PermitRootLogin no/' /etc/ssh/sshd_config
     echo "✅ Root SSH login disabled"
 fi
 
-# Enable password authentication for lab use
-sed -i 's/#PasswordAuthentication yes/PasswordAuthentication yes/' /etc/ssh/sshd_config
-sed -i 's/PasswordAuthentication no/PasswordAuthentication yes/' /etc/ssh/sshd_config
+# Password authentication stays on for lab use unless PASSWORD_AUTH is false
+if [ "$PASSWORD_AUTH" = "false" ]; then
+    sed -i 's/^#\?PasswordAuthentication .*/PasswordAuthentication no/' /etc/ssh/sshd_config
+    echo "✅ Password authentication disabled - lab key only"
+else
+    sed -i 's/^#\?PasswordAuthentication .*/PasswordAuthentication yes/' /etc/ssh/sshd_config
+    echo "✅ Password authentication enabled"
+fi
+
+mkdir -p "$(dirname "$CONFIGURED_MARKER")"
+touch "$CONFIGURED_MARKER"
 
 echo ""
 echo "🚀 Starting SystemCtl Replacement..."